@@ -0,0 +1,259 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AdminHandler serves the runtime log levels of a Logger. GET returns the
+// global level, the per-obj levels and the sinks, with the AsyncStats of those
+// writing in the background:
+//
+//	{"level": "info", "obj_levels": {"db": "warn"}, "sinks": [{"name": "...", "level": "info", "async": {"buffered": 0, "written": 10, "dropped": 0}}]}
+//
+// PUT and POST change the levels, of the configured sinks too by name. Omitted
+// fields are kept, and an obj or sink level set to "" is removed. With a ttl the
+// levels revert to what they were before the first temporary change once it
+// expires, including the permanent changes made in between:
+//
+//	{"level": "debug", "obj_levels": {"http": "trace"}, "sinks": {"stdout": "debug"}, "ttl": "10m"}
+type AdminHandler struct {
+	logger   *Logger
+	lock     sync.Mutex
+	baseline *Config
+	revert   *time.Timer
+	revertAt time.Time
+}
+
+type adminState struct {
+	Level     string            `json:"level"`
+	ObjLevels map[string]string `json:"obj_levels"`
+	Sinks     []adminSink       `json:"sinks"`
+	RevertAt  *time.Time        `json:"revert_at,omitempty"`
+}
+
+type adminSink struct {
+	Name  string      `json:"name"`
+	Level string      `json:"level"`
+	Async *AsyncStats `json:"async,omitempty"`
+}
+
+type adminChange struct {
+	Level     string            `json:"level"`
+	ObjLevels map[string]string `json:"obj_levels"`
+	Sinks     map[string]string `json:"sinks"`
+	TTL       string            `json:"ttl"`
+}
+
+// checkSinks fails for sinks the config doesn't have, as only the sinks of
+// Config.Sinks have a level of their own.
+func (change adminChange) checkSinks(config Config) error {
+	for name := range change.Sinks {
+		if config.sinkIndex(name) < 0 {
+			return fmt.Errorf("unknown sink %q", name)
+		}
+	}
+	return nil
+}
+
+// apply changes the levels of the config, skipping the sinks it doesn't have.
+func (change adminChange) apply(config *Config) {
+	if change.Level != "" {
+		config.Level = change.Level
+	}
+	for obj, level := range change.ObjLevels {
+		if level == "" {
+			delete(config.ObjLevels, obj)
+		} else {
+			config.ObjLevels[obj] = level
+		}
+	}
+	for name, level := range change.Sinks {
+		if index := config.sinkIndex(name); index >= 0 {
+			config.Sinks[index].Level = level
+		}
+	}
+}
+
+// restoreLevels sets the levels of the config back to those of the baseline.
+func restoreLevels(config *Config, baseline Config) {
+	config.Level = baseline.Level
+	config.ObjLevels = baseline.ObjLevels
+	for i, sink := range config.Sinks {
+		if index := baseline.sinkIndex(sink.name()); index >= 0 {
+			config.Sinks[i].Level = baseline.Sinks[index].Level
+		}
+	}
+}
+
+func (config Config) sinkIndex(name string) int {
+	for i, sink := range config.Sinks {
+		if sink.name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewAdminHandler creates an AdminHandler for the Logger.
+func (l *Logger) NewAdminHandler() *AdminHandler {
+	return &AdminHandler{logger: l}
+}
+
+// NewAdminHandler creates an AdminHandler for the default Logger.
+func NewAdminHandler() *AdminHandler {
+	return std.NewAdminHandler()
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.writeState(w, http.StatusOK)
+	case http.MethodPut, http.MethodPost:
+		h.change(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AdminHandler) change(w http.ResponseWriter, r *http.Request) {
+	var change adminChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if change.TTL != "" {
+		parsed, err := time.ParseDuration(change.TTL)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", change.TTL), http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	previous := h.logger.currentConfig()
+	if err := change.checkSinks(previous); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := h.logger.reloadWith(func(config *Config) {
+		change.apply(config)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if ttl == 0 {
+		h.keepChange(change)
+	} else {
+		h.scheduleRevert(previous, ttl)
+	}
+	h.writeStateLocked(w, http.StatusOK)
+}
+
+// keepChange makes a permanent change survive a pending revert, which restores
+// the levels as they were before the temporary change, with this one applied.
+func (h *AdminHandler) keepChange(change adminChange) {
+	if h.baseline != nil {
+		change.apply(h.baseline)
+	}
+}
+
+// scheduleRevert remembers the levels to revert to for a temporary change.
+func (h *AdminHandler) scheduleRevert(previous Config, ttl time.Duration) {
+	if h.revert != nil {
+		h.revert.Stop()
+		h.revert = nil
+	}
+
+	if h.baseline == nil {
+		h.baseline = &previous
+	}
+	baseline := h.baseline
+	h.revertAt = time.Now().Add(ttl)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if h.revert != timer {
+			return
+		}
+
+		err := h.logger.reloadWith(func(config *Config) {
+			restoreLevels(config, *baseline)
+		})
+		if err != nil {
+			h.logger.GetLog("logging").Error("Failed to revert log levels: ", err)
+		}
+		h.baseline = nil
+		h.revert = nil
+	})
+	h.revert = timer
+}
+
+func (h *AdminHandler) writeState(w http.ResponseWriter, status int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.writeStateLocked(w, status)
+}
+
+func (h *AdminHandler) writeStateLocked(w http.ResponseWriter, status int) {
+	config := h.logger.currentConfig()
+	state := adminState{
+		Level:     config.Level,
+		ObjLevels: config.ObjLevels,
+		Sinks:     make([]adminSink, 0),
+	}
+	for _, sink := range h.logger.runningSinks() {
+		adminSink := adminSink{Name: sink.name, Level: sink.applied.String()}
+		if async, ok := sink.hook.(*AsyncJsonLogHook); ok {
+			stats := async.Stats()
+			adminSink.Async = &stats
+		}
+		state.Sinks = append(state.Sinks, adminSink)
+	}
+	if h.revert != nil {
+		revertAt := h.revertAt
+		state.RevertAt = &revertAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(state)
+}
+
+// currentConfig returns a copy of the config the Logger is running with.
+func (l *Logger) currentConfig() Config {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.config.copy()
+}
+
+// runningSinks returns the sinks of the Logger sorted by name.
+func (l *Logger) runningSinks() []runningSink {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	sinks := make([]runningSink, 0, len(l.sinks))
+	for _, sink := range l.sinks {
+		sinks = append(sinks, sink)
+	}
+	sort.Slice(sinks, func(i, j int) bool {
+		return sinks[i].name < sinks[j].name
+	})
+	return sinks
+}
@@ -0,0 +1,153 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AdminHandlerGetShouldShowLevelsAndSinks(t *testing.T) {
+	logger, err := New(Config{
+		Level:         "info",
+		AppName:       appName,
+		LogsFolder:    t.TempDir(),
+		LogToJsonFile: true,
+		ObjLevels:     map[string]string{"db": "warn"},
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	response, state := serveAdmin(t, logger.NewAdminHandler(), http.MethodGet, "")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "info", state.Level)
+	assert.Equal(t, map[string]string{"db": "warn"}, state.ObjLevels)
+	assert.Len(t, state.Sinks, 1)
+	assert.Nil(t, state.RevertAt)
+}
+
+func Test_AdminHandlerPutShouldChangeLevels(t *testing.T) {
+	logger, err := New(Config{Level: "info", ObjLevels: map[string]string{"db": "warn", "http": "trace"}})
+	assert.NoError(t, err)
+
+	response, state := serveAdmin(t, logger.NewAdminHandler(), http.MethodPut,
+		`{"level": "debug", "obj_levels": {"db": "error", "http": ""}}`)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "debug", state.Level)
+	assert.Equal(t, map[string]string{"db": "error"}, state.ObjLevels)
+	assert.Equal(t, logrus.DebugLevel, logger.logger.GetLevel())
+}
+
+func Test_AdminHandlerShouldRevertTemporaryChangesAfterTTL(t *testing.T) {
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+	handler := logger.NewAdminHandler()
+
+	serveAdmin(t, handler, http.MethodPost, `{"level": "debug", "ttl": "50ms"}`)
+	_, state := serveAdmin(t, handler, http.MethodPost, `{"obj_levels": {"db": "trace"}, "ttl": "50ms"}`)
+
+	assert.NotNil(t, state.RevertAt)
+	assert.Equal(t, "debug", logger.currentConfig().Level)
+	assert.Eventually(t, func() bool {
+		config := logger.currentConfig()
+		return config.Level == "info" && len(config.ObjLevels) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_AdminHandlerPermanentChangeShouldNotCancelPendingRevert(t *testing.T) {
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+	handler := logger.NewAdminHandler()
+
+	serveAdmin(t, handler, http.MethodPut, `{"level": "debug", "ttl": "50ms"}`)
+	_, state := serveAdmin(t, handler, http.MethodPut, `{"obj_levels": {"db": "warn"}}`)
+
+	assert.NotNil(t, state.RevertAt)
+	assert.Equal(t, "debug", state.Level)
+	assert.Eventually(t, func() bool {
+		config := logger.currentConfig()
+		return config.Level == "info" && config.ObjLevels["db"] == "warn"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_AdminHandlerShouldChangeSinkLevels(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger, err := New(Config{
+		Level: "info",
+		Sinks: []SinkConfig{{Name: "audit", Destination: DestinationWriter, Writer: output, Level: "error"}},
+	})
+	assert.NoError(t, err)
+	handler := logger.NewAdminHandler()
+
+	_, state := serveAdmin(t, handler, http.MethodPut, `{"sinks": {"audit": "info"}, "ttl": "50ms"}`)
+	assert.Equal(t, []adminSink{{Name: "audit", Level: "info"}}, state.Sinks)
+	logger.GetLog("db").Info("querying")
+	assert.Contains(t, output.String(), "querying")
+
+	assert.Eventually(t, func() bool {
+		return logger.currentConfig().Sinks[0].Level == "error"
+	}, time.Second, 10*time.Millisecond)
+	output.Reset()
+	logger.GetLog("db").Info("querying")
+	assert.Empty(t, output.String())
+
+	response, _ := serveAdmin(t, handler, http.MethodPut, `{"sinks": {"stdout": "debug"}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func Test_AdminHandlerShouldShowTheLevelAppliedBySinks(t *testing.T) {
+	logger, err := New(Config{
+		Level:         "info",
+		AppName:       appName,
+		LogsFolder:    t.TempDir(),
+		LogToJsonFile: true,
+		ObjLevels:     map[string]string{"db": "trace"},
+		Sinks: []SinkConfig{
+			{Name: "all", Destination: DestinationWriter, Writer: &bytes.Buffer{}},
+			{Name: "errors", Destination: DestinationWriter, Writer: &bytes.Buffer{}, Level: "error"},
+		},
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	_, state := serveAdmin(t, logger.NewAdminHandler(), http.MethodGet, "")
+
+	assert.Equal(t, []adminSink{
+		{Name: "all", Level: "info"},
+		{Name: "errors", Level: "error"},
+		{Name: "json_file " + jsonLogFileName(logger.currentConfig()), Level: "info"},
+	}, state.Sinks)
+}
+
+func Test_AdminHandlerShouldRejectInvalidRequests(t *testing.T) {
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+	handler := logger.NewAdminHandler()
+
+	for _, body := range []string{`{"level": "loud"}`, `{"ttl": "soon"}`, `{"sinks": {"console": "info"}}`, `not json`} {
+		response, _ := serveAdmin(t, handler, http.MethodPut, body)
+		assert.Equal(t, http.StatusBadRequest, response.Code, body)
+	}
+	response, _ := serveAdmin(t, handler, http.MethodDelete, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+	assert.Equal(t, "info", logger.currentConfig().Level)
+}
+
+func serveAdmin(t *testing.T, handler http.Handler, method string, body string) (*httptest.ResponseRecorder, adminState) {
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(method, "/logging", strings.NewReader(body)))
+
+	var state adminState
+	if response.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &state))
+	}
+	return response, state
+}
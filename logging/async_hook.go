@@ -0,0 +1,369 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy decides what an AsyncJsonLogHook does with an entry fired
+// while its buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock makes the caller wait for room in the buffer.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropNewest drops the entry being fired.
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	// OverflowDropOldest drops the oldest buffered entry to make room.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDropBelowLevel drops the entries less severe than
+	// AsyncOptions.DropBelowLevel, the oldest buffered one first, and blocks
+	// for the others.
+	OverflowDropBelowLevel OverflowPolicy = "drop_below_level"
+)
+
+// FieldNameDropped holds the number of dropped entries in a summary entry.
+const FieldNameDropped = "dropped"
+
+// errorOutput receives the errors of background writers, which have no caller
+// to return them to.
+var errorOutput io.Writer = os.Stderr
+
+const (
+	defaultAsyncBufferSize = 4096
+	defaultAsyncBatchSize  = 256
+)
+
+// AsyncOptions configures an AsyncJsonLogHook. Zero values pick the defaults:
+// a buffer of 4096 entries, batches of 256 entries and OverflowBlock.
+type AsyncOptions struct {
+	BufferSize     int            `json:"buffer_size" yaml:"buffer_size" toml:"buffer_size" env:"ASYNC_BUFFER_SIZE"`
+	BatchSize      int            `json:"batch_size" yaml:"batch_size" toml:"batch_size" env:"ASYNC_BATCH_SIZE"`
+	Overflow       OverflowPolicy `json:"overflow" yaml:"overflow" toml:"overflow" env:"ASYNC_OVERFLOW"`
+	DropBelowLevel string         `json:"drop_below_level" yaml:"drop_below_level" toml:"drop_below_level" env:"ASYNC_DROP_BELOW_LEVEL"`
+}
+
+// AsyncStats are the counters of an AsyncJsonLogHook.
+type AsyncStats struct {
+	// Buffered is the number of entries waiting to be written.
+	Buffered int `json:"buffered"`
+	// Written is the number of entries written so far.
+	Written uint64 `json:"written"`
+	// Dropped is the number of entries dropped by the overflow policy so far.
+	Dropped uint64 `json:"dropped"`
+}
+
+// AsyncJsonLogHook writes the entries of a JsonLogHook from a background
+// goroutine, so a slow disk doesn't stall the callers. Entries wait in a bounded
+// ring buffer and are written in batches; a full buffer is handled by the
+// configured OverflowPolicy. Once the buffer drains below half after entries
+// were dropped, a warning saying how many is written.
+//
+// Fatal and panic entries are written before Fire returns, since the process is
+// about to stop.
+type AsyncJsonLogHook struct {
+	hook      *JsonLogHook
+	batchSize int
+	overflow  OverflowPolicy
+	dropBelow logrus.Level
+
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	drained  *sync.Cond
+	ring     []*logrus.Entry
+	head     int
+	count    int
+	writing  bool
+	closed   bool
+	written  uint64
+	dropped  uint64
+	// summaryLogger is the logger of the summary entries.
+	summaryLogger *logrus.Logger
+	// unreported counts the drops not yet reported by a summary entry.
+	unreported uint64
+
+	done chan struct{}
+}
+
+// NewAsyncJsonLogHook starts writing the entries of hook in the background.
+// Closing the returned hook writes the buffered entries and closes hook.
+func NewAsyncJsonLogHook(hook *JsonLogHook, options AsyncOptions) (*AsyncJsonLogHook, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	bufferSize, batchSize := options.BufferSize, options.BatchSize
+	if bufferSize == 0 {
+		bufferSize = defaultAsyncBufferSize
+	}
+	if batchSize == 0 {
+		batchSize = defaultAsyncBatchSize
+	}
+	overflow := options.Overflow
+	if overflow == "" {
+		overflow = OverflowBlock
+	}
+	dropBelow := logrus.WarnLevel
+	if options.DropBelowLevel != "" {
+		dropBelow, _ = logrus.ParseLevel(options.DropBelowLevel)
+	}
+
+	retVal := &AsyncJsonLogHook{
+		hook:          hook,
+		batchSize:     batchSize,
+		overflow:      overflow,
+		dropBelow:     dropBelow,
+		ring:          make([]*logrus.Entry, bufferSize),
+		summaryLogger: logrus.New(),
+		done:          make(chan struct{}),
+	}
+	retVal.notEmpty = sync.NewCond(&retVal.lock)
+	retVal.notFull = sync.NewCond(&retVal.lock)
+	retVal.drained = sync.NewCond(&retVal.lock)
+	hook.bufferWrites()
+
+	go retVal.run()
+
+	return retVal, nil
+}
+
+func (options AsyncOptions) validate() error {
+	if options.BufferSize < 0 {
+		return fmt.Errorf("buffer size %d is negative", options.BufferSize)
+	}
+	if options.BatchSize < 0 {
+		return fmt.Errorf("batch size %d is negative", options.BatchSize)
+	}
+	switch options.Overflow {
+	case "", OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowDropBelowLevel:
+	default:
+		return fmt.Errorf("unknown overflow policy %q", options.Overflow)
+	}
+	if options.DropBelowLevel != "" {
+		if _, err := logrus.ParseLevel(options.DropBelowLevel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Levels Required for logrus hook implementation
+func (h *AsyncJsonLogHook) Levels() []logrus.Level {
+	return h.hook.Levels()
+}
+
+// Fire buffers a copy of the entry for the background writer.
+func (h *AsyncJsonLogHook) Fire(entry *logrus.Entry) error {
+	if !h.hook.fileLogEntry.Logger.IsLevelEnabled(entry.Level) {
+		return nil
+	}
+
+	buffered := entry.Dup()
+	buffered.Level = entry.Level
+	buffered.Message = entry.Message
+	buffered.Caller = entry.Caller
+
+	h.lock.Lock()
+	if err := h.push(buffered); err != nil {
+		h.lock.Unlock()
+		return err
+	}
+	h.lock.Unlock()
+
+	if entry.Level <= logrus.FatalLevel {
+		return h.Flush()
+	}
+	return nil
+}
+
+// push adds the entry to the ring buffer, applying the overflow policy when it
+// is full. It must be called with the lock held.
+func (h *AsyncJsonLogHook) push(entry *logrus.Entry) error {
+	for !h.closed && h.count == len(h.ring) {
+		switch {
+		case entry.Level <= logrus.FatalLevel || h.overflow == OverflowBlock:
+			h.notFull.Wait()
+		case h.overflow == OverflowDropNewest:
+			h.drop()
+			return nil
+		case h.overflow == OverflowDropOldest:
+			h.ring[h.head] = nil
+			h.head = (h.head + 1) % len(h.ring)
+			h.count--
+			h.drop()
+		case entry.Level > h.dropBelow:
+			h.drop()
+			return nil
+		case !h.evictBelowLevel():
+			h.notFull.Wait()
+		}
+	}
+	if h.closed {
+		return ErrSinkClosed
+	}
+
+	h.ring[(h.head+h.count)%len(h.ring)] = entry
+	h.count++
+	h.notEmpty.Signal()
+	return nil
+}
+
+// evictBelowLevel drops the oldest buffered entry less severe than dropBelow
+// and reports whether there was one.
+func (h *AsyncJsonLogHook) evictBelowLevel() bool {
+	for i := 0; i < h.count; i++ {
+		if h.ring[(h.head+i)%len(h.ring)].Level <= h.dropBelow {
+			continue
+		}
+		for j := i; j > 0; j-- {
+			h.ring[(h.head+j)%len(h.ring)] = h.ring[(h.head+j-1)%len(h.ring)]
+		}
+		h.ring[h.head] = nil
+		h.head = (h.head + 1) % len(h.ring)
+		h.count--
+		h.drop()
+		return true
+	}
+	return false
+}
+
+func (h *AsyncJsonLogHook) drop() {
+	h.dropped++
+	h.unreported++
+}
+
+// Stats returns the counters of the hook.
+func (h *AsyncJsonLogHook) Stats() AsyncStats {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return AsyncStats{
+		Buffered: h.count,
+		Written:  h.written,
+		Dropped:  h.dropped,
+	}
+}
+
+// SetLevel changes the minimum level written by the hook.
+func (h *AsyncJsonLogHook) SetLevel(level logrus.Level) {
+	h.hook.SetLevel(level)
+}
+
+// Level returns the minimum level written by the hook.
+func (h *AsyncJsonLogHook) Level() logrus.Level {
+	return h.hook.Level()
+}
+
+// Flush waits for the buffered entries to be written and flushes the hook.
+func (h *AsyncJsonLogHook) Flush() error {
+	h.lock.Lock()
+	for h.count > 0 || h.writing {
+		h.drained.Wait()
+	}
+	h.lock.Unlock()
+
+	return h.hook.Flush()
+}
+
+// Close writes the buffered entries, stops the background writer and closes
+// the wrapped hook. Entries fired after Close fail with ErrSinkClosed.
+func (h *AsyncJsonLogHook) Close() error {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return nil
+	}
+	h.closed = true
+	h.notEmpty.Broadcast()
+	h.notFull.Broadcast()
+	h.lock.Unlock()
+
+	<-h.done
+	return h.hook.Close()
+}
+
+func (h *AsyncJsonLogHook) run() {
+	defer close(h.done)
+
+	for {
+		batch, ok := h.nextBatch()
+		if !ok {
+			h.reportDrops()
+			return
+		}
+
+		for _, entry := range batch {
+			if err := h.hook.Fire(entry); err != nil {
+				fmt.Fprintf(errorOutput, "Failed to write buffered log entry: %v\n", err)
+			}
+		}
+		h.reportDrops()
+		if err := h.hook.Flush(); err != nil {
+			fmt.Fprintf(errorOutput, "Failed to flush buffered log entries: %v\n", err)
+		}
+
+		h.lock.Lock()
+		h.written += uint64(len(batch))
+		h.writing = false
+		h.drained.Broadcast()
+		h.lock.Unlock()
+	}
+}
+
+// nextBatch waits for entries and takes up to batchSize of them. It returns
+// false once the hook is closed and the buffer is empty.
+func (h *AsyncJsonLogHook) nextBatch() ([]*logrus.Entry, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for h.count == 0 {
+		if h.closed {
+			return nil, false
+		}
+		h.notEmpty.Wait()
+	}
+
+	size := h.count
+	if size > h.batchSize {
+		size = h.batchSize
+	}
+	batch := make([]*logrus.Entry, size)
+	for i := range batch {
+		batch[i] = h.ring[h.head]
+		h.ring[h.head] = nil
+		h.head = (h.head + 1) % len(h.ring)
+	}
+	h.count -= size
+	h.writing = true
+	h.notFull.Broadcast()
+
+	return batch, true
+}
+
+// reportDrops writes a summary of the dropped entries once the buffer is below
+// half full again.
+func (h *AsyncJsonLogHook) reportDrops() {
+	h.lock.Lock()
+	dropped := h.unreported
+	if dropped == 0 || h.count*2 >= len(h.ring) {
+		h.lock.Unlock()
+		return
+	}
+	h.unreported = 0
+	h.lock.Unlock()
+
+	summary := logrus.NewEntry(h.summaryLogger).WithFields(logrus.Fields{
+		FieldNameObj:     "logging",
+		FieldNameDropped: dropped,
+	})
+	summary.Level = logrus.WarnLevel
+	summary.Message = fmt.Sprintf("%d entries dropped", dropped)
+	if err := h.hook.Fire(summary); err != nil {
+		fmt.Fprintf(errorOutput, "Failed to write dropped entries summary: %v\n", err)
+	}
+}
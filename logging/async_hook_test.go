@@ -0,0 +1,226 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AsyncJsonLogHookShouldWriteEntriesInTheBackground(t *testing.T) {
+	writer := newGatedWriter()
+	writer.open()
+	hook := newTestAsyncHook(t, writer, AsyncOptions{})
+
+	for i := 0; i < 10; i++ {
+		fireMessage(hook, logrus.InfoLevel, "Test")
+	}
+	assert.NoError(t, hook.Flush())
+
+	assert.Len(t, writer.messages(), 10)
+	assert.Equal(t, AsyncStats{Written: 10}, hook.Stats())
+}
+
+func Test_AsyncJsonLogHookOverflowPolicies(t *testing.T) {
+	cases := map[OverflowPolicy][]string{
+		OverflowDropNewest:     {"1", "info 2", "error 3", "2 entries dropped"},
+		OverflowDropOldest:     {"1", "info 4", "error 5", "2 entries dropped"},
+		OverflowDropBelowLevel: {"1", "error 3", "error 5", "2 entries dropped"},
+	}
+
+	for policy, expected := range cases {
+		writer := newGatedWriter()
+		hook := newTestAsyncHook(t, writer, AsyncOptions{BufferSize: 2, BatchSize: 1, Overflow: policy})
+		fireAndWaitUntilWriting(hook, "1")
+
+		fireMessage(hook, logrus.InfoLevel, "info 2")
+		fireMessage(hook, logrus.ErrorLevel, "error 3")
+		fireMessage(hook, logrus.InfoLevel, "info 4")
+		fireMessage(hook, logrus.ErrorLevel, "error 5")
+		writer.open()
+		assert.NoError(t, hook.Close(), policy)
+
+		assert.Equal(t, expected, writer.messages(), policy)
+		assert.Equal(t, uint64(2), hook.Stats().Dropped, policy)
+	}
+}
+
+func Test_AsyncJsonLogHookShouldBlockWhenFull(t *testing.T) {
+	writer := newGatedWriter()
+	hook := newTestAsyncHook(t, writer, AsyncOptions{BufferSize: 1, BatchSize: 1})
+	fireAndWaitUntilWriting(hook, "1")
+	fireMessage(hook, logrus.InfoLevel, "2")
+
+	fired := make(chan struct{})
+	go func() {
+		fireMessage(hook, logrus.InfoLevel, "3")
+		close(fired)
+	}()
+	select {
+	case <-fired:
+		t.Fatal("Fire should block while the buffer is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	writer.open()
+	<-fired
+	assert.NoError(t, hook.Close())
+	assert.Equal(t, []string{"1", "2", "3"}, writer.messages())
+}
+
+func Test_AsyncJsonLogHookShouldWriteFatalEntriesBeforeReturning(t *testing.T) {
+	writer := newGatedWriter()
+	writer.open()
+	hook := newTestAsyncHook(t, writer, AsyncOptions{})
+
+	fireMessage(hook, logrus.InfoLevel, "info")
+	fireMessage(hook, logrus.FatalLevel, "fatal")
+
+	assert.Equal(t, []string{"info", "fatal"}, writer.messages())
+}
+
+func Test_AsyncJsonLogHookShouldRejectEntriesAfterClose(t *testing.T) {
+	writer := newGatedWriter()
+	writer.open()
+	hook := newTestAsyncHook(t, writer, AsyncOptions{})
+
+	assert.NoError(t, hook.Close())
+
+	assert.Equal(t, ErrSinkClosed, fireMessage(hook, logrus.InfoLevel, "Test"))
+}
+
+func Test_NewAsyncJsonLogHookShouldValidateOptions(t *testing.T) {
+	for _, options := range []AsyncOptions{{BufferSize: -1}, {Overflow: "explode"}, {DropBelowLevel: "loud"}} {
+		_, err := NewAsyncJsonLogHook(NewJsonLogHook(logrus.InfoLevel, LoggerFields{}, new(bytes.Buffer)), options)
+		assert.Error(t, err)
+	}
+}
+
+func Test_LoggerWithAsyncOptionsShouldWriteTheJsonFileAsynchronously(t *testing.T) {
+	folder := t.TempDir()
+	logger, err := New(Config{
+		Level:         "info",
+		AppName:       appName,
+		LogsFolder:    folder,
+		LogToJsonFile: true,
+		Async:         AsyncOptions{BufferSize: 16, Overflow: OverflowDropNewest},
+	})
+	assert.NoError(t, err)
+
+	logger.GetLog("test").Info("Test")
+	assert.NoError(t, logger.Flush())
+	name := "json_file " + path.Join(folder, appName+"_logstash_json.log")
+	assert.Equal(t, map[string]AsyncStats{name: {Written: 2}}, logger.Stats())
+	_, state := serveAdmin(t, logger.NewAdminHandler(), http.MethodGet, "")
+	assert.Equal(t, []adminSink{{Name: name, Level: "info", Async: &AsyncStats{Written: 2}}}, state.Sinks)
+	assert.NoError(t, logger.Close())
+
+	assert.Len(t, loadLogFile(path.Join(folder, appName+"_logstash_json.log")), 2)
+}
+
+func Test_AsyncJsonLogHookShouldOnlyWriteWholeEntries(t *testing.T) {
+	writer := &recordingWriter{}
+	hook, err := NewAsyncJsonLogHook(NewJsonLogHook(logrus.InfoLevel, LoggerFields{}, writer), AsyncOptions{})
+	assert.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		fireMessage(hook, logrus.InfoLevel, strings.Repeat("x", 1000))
+	}
+	assert.NoError(t, hook.Close())
+
+	entries := 0
+	assert.Greater(t, len(writer.writes), 1)
+	for _, write := range writer.writes {
+		assert.True(t, strings.HasPrefix(write, "{") && strings.HasSuffix(write, "}\n"))
+		entries += strings.Count(write, "\n")
+	}
+	assert.Equal(t, 20, entries)
+}
+
+// recordingWriter keeps each write apart.
+type recordingWriter struct {
+	writes []string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func newTestAsyncHook(t *testing.T, writer *gatedWriter, options AsyncOptions) *AsyncJsonLogHook {
+	hook, err := NewAsyncJsonLogHook(NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, writer), options)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		writer.open()
+		hook.Close()
+	})
+	return hook
+}
+
+// fireAndWaitUntilWriting fires an entry and waits for the background writer
+// to be busy writing it.
+func fireAndWaitUntilWriting(hook *AsyncJsonLogHook, message string) {
+	fireMessage(hook, logrus.InfoLevel, message)
+	for {
+		hook.lock.Lock()
+		writing := hook.writing
+		hook.lock.Unlock()
+		if writing {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func fireMessage(hook logrus.Hook, level logrus.Level, message string) error {
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = level
+	entry.Message = message
+	return hook.Fire(entry)
+}
+
+// gatedWriter blocks writes until it is opened.
+type gatedWriter struct {
+	gate     chan struct{}
+	openOnce sync.Once
+	lock     sync.Mutex
+	buffer   bytes.Buffer
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{})}
+}
+
+func (w *gatedWriter) open() {
+	w.openOnce.Do(func() {
+		close(w.gate)
+	})
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buffer.Write(p)
+}
+
+func (w *gatedWriter) messages() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	messages := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(w.buffer.String()), "\n") {
+		var entry map[string]interface{}
+		if json.Unmarshal([]byte(line), &entry) == nil {
+			messages = append(messages, entry["message"].(string))
+		}
+	}
+	return messages
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultBackoffMinDelay = 100 * time.Millisecond
+	defaultBackoffMaxDelay = 30 * time.Second
+)
+
+// BackoffConfig is how long a sink waits between its attempts to reach its
+// destination: the delay doubles from MinDelay up to MaxDelay, and a random
+// jitter of up to half of it is taken off so that many instances don't retry
+// together.
+type BackoffConfig struct {
+	// MinDelay defaults to 100ms.
+	MinDelay string `json:"min_delay" yaml:"min_delay" toml:"min_delay"`
+	// MaxDelay defaults to 30s.
+	MaxDelay string `json:"max_delay" yaml:"max_delay" toml:"max_delay"`
+}
+
+func (config BackoffConfig) validate(field string, configErr *ConfigError) {
+	durations := []struct{ name, value string }{
+		{"MinDelay", config.MinDelay},
+		{"MaxDelay", config.MaxDelay},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		if parsed, err := time.ParseDuration(duration.value); err != nil {
+			configErr.add(field+"."+duration.name, err)
+		} else if parsed <= 0 {
+			configErr.add(field+"."+duration.name, fmt.Errorf("%s is not positive", duration.value))
+		}
+	}
+}
+
+// backoff returns the delays of config.
+func (config BackoffConfig) backoff() *backoff {
+	retVal := &backoff{min: defaultBackoffMinDelay, max: defaultBackoffMaxDelay}
+	if config.MinDelay != "" {
+		retVal.min, _ = time.ParseDuration(config.MinDelay)
+	}
+	if config.MaxDelay != "" {
+		retVal.max, _ = time.ParseDuration(config.MaxDelay)
+	}
+	if retVal.max < retVal.min {
+		retVal.max = retVal.min
+	}
+	return retVal
+}
+
+// backoff computes the delays between the attempts of a sink. It is not safe
+// for concurrent use.
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+// next returns the delay before the next attempt.
+func (b *backoff) next() time.Duration {
+	delay := b.min
+	for i := 0; i < b.attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay >= b.max {
+		delay = b.max
+	} else {
+		b.attempt++
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// reset makes the next delay the shortest again, after a success.
+func (b *backoff) reset() {
+	b.attempt = 0
+}
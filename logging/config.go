@@ -0,0 +1,242 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConfigError is returned when a Config fails validation. It lists every
+// problem that was found, so they can all be reported at once.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+// ConfigProblem describes a single invalid Config field.
+type ConfigProblem struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.Error()
+	}
+	return "invalid logging config: " + strings.Join(problems, "; ")
+}
+
+func (e *ConfigError) add(field string, err error) {
+	e.Problems = append(e.Problems, ConfigProblem{Field: field, Err: err})
+}
+
+func (p ConfigProblem) Error() string {
+	return fmt.Sprintf("%s: %v", p.Field, p.Err)
+}
+
+func (p ConfigProblem) Unwrap() error {
+	return p.Err
+}
+
+// Validate checks the level, the JSON log file settings, the sinks and the
+// additional fields. It returns a *ConfigError listing every problem, or nil.
+func (config Config) Validate() error {
+	configErr := &ConfigError{}
+
+	if _, err := logrus.ParseLevel(config.Level); err != nil {
+		configErr.add("Level", err)
+	}
+
+	for _, obj := range sortedObjs(config.ObjLevels) {
+		if _, err := logrus.ParseLevel(config.ObjLevels[obj]); err != nil {
+			configErr.add(fmt.Sprintf("ObjLevels[%s]", obj), err)
+		}
+	}
+
+	if config.MaxSizeMB < 0 {
+		configErr.add("MaxSizeMB", fmt.Errorf("%d is negative", config.MaxSizeMB))
+	}
+	if config.MaxBackups < 0 {
+		configErr.add("MaxBackups", fmt.Errorf("%d is negative", config.MaxBackups))
+	}
+
+	config.Rotation.validate("Rotation", configErr)
+
+	if err := config.Async.validate(); err != nil {
+		configErr.add("Async", err)
+	}
+
+	if config.LogToJsonFile || config.LogErrorsToJsonFile {
+		appNameValid := true
+		if err := validateAppName(config.AppName); err != nil {
+			configErr.add("AppName", err)
+			appNameValid = false
+		}
+		if err := validateLogsFolder(config.LogsFolder); err != nil {
+			configErr.add("LogsFolder", err)
+		} else if appNameValid {
+			if config.LogToJsonFile {
+				if err := validateLogFile(jsonLogFileName(config)); err != nil {
+					configErr.add("LogsFolder", err)
+				}
+			}
+			if config.LogErrorsToJsonFile {
+				if err := validateLogFile(errorsLogFileName(config)); err != nil {
+					configErr.add("LogsFolder", err)
+				}
+			}
+		}
+	}
+	config.ErrorsRotation.validate("ErrorsRotation", configErr)
+	config.Redaction.validate("Redaction", configErr)
+	config.Sampling.validate("Sampling", configErr)
+	config.Dedup.validate("Dedup", configErr)
+	config.TailBuffer.validate("TailBuffer", configErr)
+	config.TraceIds.validate("TraceIds", configErr)
+
+	for i, sink := range config.Sinks {
+		sink.validate(fmt.Sprintf("Sinks[%d]", i), configErr)
+	}
+
+	fields := []struct{ name, value string }{
+		{"AdditionalFields.ArtifactID", config.AdditionalFields.ArtifactID},
+		{"AdditionalFields.ArtifactVersion", config.AdditionalFields.ArtifactVersion},
+		{"AdditionalFields.Hostname", config.AdditionalFields.Hostname},
+		{"AdditionalFields.Dc", config.AdditionalFields.Dc},
+	}
+	for _, field := range fields {
+		if err := validateFieldValue(field.value); err != nil {
+			configErr.add(field.name, err)
+		}
+	}
+
+	if len(configErr.Problems) > 0 {
+		return configErr
+	}
+	return nil
+}
+
+// copy returns a copy of config that shares no maps with it.
+func (config Config) copy() Config {
+	objLevels := make(map[string]string, len(config.ObjLevels))
+	for obj, level := range config.ObjLevels {
+		objLevels[obj] = level
+	}
+	config.ObjLevels = objLevels
+	config.Sinks = append([]SinkConfig(nil), config.Sinks...)
+	for i := range config.Sinks {
+		config.Sinks[i].HTTP = config.Sinks[i].HTTP.copy()
+	}
+	config.Redaction = config.Redaction.copy()
+	config.Sampling = config.Sampling.copy()
+	config.Dedup = config.Dedup.copy()
+	return config
+}
+
+// rotationPolicy returns the rotation of the log files: Rotation, limited by
+// MaxSizeMB and MaxBackups unless it sets its own limits. Files limited by
+// MaxSizeMB or MaxBackups keep their backups for 7 days by default, as they
+// always have.
+func (config Config) rotationPolicy() RotationPolicy {
+	policy := config.Rotation
+	if policy.MaxSizeMB == 0 {
+		policy.MaxSizeMB = config.MaxSizeMB
+	}
+	if policy.MaxBackups == 0 {
+		policy.MaxBackups = config.MaxBackups
+	}
+	if policy.MaxAgeDays == 0 && (config.MaxSizeMB != 0 || config.MaxBackups != 0) {
+		policy.MaxAgeDays = 7
+	}
+	return policy.withDefaults()
+}
+
+// errorsRotationPolicy returns the rotation of the errors log file:
+// ErrorsRotation, keeping 10 backups for 90 days by default.
+func (config Config) errorsRotationPolicy() RotationPolicy {
+	policy := config.ErrorsRotation
+	if policy.MaxBackups == 0 {
+		policy.MaxBackups = 10
+	}
+	if policy.MaxAgeDays == 0 {
+		policy.MaxAgeDays = 90
+	}
+	return policy.withDefaults()
+}
+
+func sortedObjs(objLevels map[string]string) []string {
+	objs := make([]string, 0, len(objLevels))
+	for obj := range objLevels {
+		objs = append(objs, obj)
+	}
+	sort.Strings(objs)
+	return objs
+}
+
+func jsonLogFileName(config Config) string {
+	shortLogFileName := fmt.Sprintf("%s_logstash_json.log", config.AppName)
+	return path.Join(config.LogsFolder, shortLogFileName)
+}
+
+func errorsLogFileName(config Config) string {
+	shortLogFileName := fmt.Sprintf("%s_errors_json.log", config.AppName)
+	return path.Join(config.LogsFolder, shortLogFileName)
+}
+
+func validateAppName(appName string) error {
+	if appName == "" {
+		return errors.New("required to name the JSON log file")
+	}
+	if appName == "." || appName == ".." || strings.ContainsAny(appName, `/\:*?"<>|`) {
+		return fmt.Errorf("%q can't be used in a file name", appName)
+	}
+	return validateFieldValue(appName)
+}
+
+func validateLogsFolder(folder string) error {
+	if folder == "" {
+		folder = "."
+	}
+
+	info, err := os.Stat(folder)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", folder)
+	}
+
+	probe, err := os.CreateTemp(folder, ".logging-probe-*")
+	if err != nil {
+		return fmt.Errorf("%q is not writable: %w", folder, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func validateLogFile(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not writable: %w", fileName, err)
+	}
+	return file.Close()
+}
+
+func validateFieldValue(value string) error {
+	if strings.TrimSpace(value) != value {
+		return fmt.Errorf("%q has leading or trailing whitespace", value)
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%q contains control characters", value)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package logging
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfig returns the configuration the default Logger starts with.
+func DefaultConfig() Config {
+	return Config{
+		Level:  "debug",
+		Colors: false,
+	}
+}
+
+// LoadConfig builds a Config with the precedence defaults < file < env: it starts
+// from DefaultConfig, overlays the settings found in fileName (skipped when
+// empty) and then the environment variables starting with envPrefix.
+func LoadConfig(fileName string, envPrefix string) (Config, error) {
+	config := DefaultConfig()
+	if fileName != "" {
+		if err := applyConfigFile(&config, fileName); err != nil {
+			return config, err
+		}
+	}
+
+	err := applyConfigEnv(&config, envPrefix)
+	return config, err
+}
+
+// LoadConfigFile overlays DefaultConfig with the settings found in fileName.
+// The format is picked by extension: .json, .yaml/.yml or .toml. Keys are the
+// snake_case field names, e.g.
+//
+//	level: info
+//	log_to_json_file: true
+//	additional_fields:
+//	  artifact_id: com.wixpress.artifact
+//
+// Unknown keys are reported as errors.
+func LoadConfigFile(fileName string) (Config, error) {
+	config := DefaultConfig()
+	err := applyConfigFile(&config, fileName)
+	return config, err
+}
+
+// ConfigFromEnv overlays DefaultConfig with environment variables named after
+// the upper-case field names, joined to prefix with an underscore, e.g.
+// ConfigFromEnv("LOG") reads LOG_LEVEL, LOG_APP_NAME and LOG_ARTIFACT_ID. Values
+// that can't be parsed are reported as a *ConfigError.
+func ConfigFromEnv(prefix string) (Config, error) {
+	config := DefaultConfig()
+	err := applyConfigEnv(&config, prefix)
+	return config, err
+}
+
+func applyConfigFile(config *Config, fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err == nil {
+		err = decodeConfig(config, data, strings.ToLower(filepath.Ext(fileName)))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load logging config from %s: %w", fileName, err)
+	}
+	return nil
+}
+
+func decodeConfig(config *Config, data []byte, extension string) error {
+	switch extension {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(config)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != io.EOF {
+			return err
+		}
+		return nil
+	case ".toml":
+		metadata, err := toml.Decode(string(data), config)
+		if err == nil && len(metadata.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown keys %v", metadata.Undecoded())
+		}
+		return err
+	}
+	return fmt.Errorf("unsupported config file extension %q", extension)
+}
+
+func applyConfigEnv(config *Config, prefix string) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+
+	configErr := &ConfigError{}
+	applyEnvToStruct(reflect.ValueOf(config).Elem(), prefix, configErr)
+
+	if len(configErr.Problems) > 0 {
+		return configErr
+	}
+	return nil
+}
+
+// applyEnvToStruct sets every field tagged with `env` from the variable named
+// prefix+tag. Nested structs are walked with their tag, if any, appended to the
+// prefix.
+func applyEnvToStruct(value reflect.Value, prefix string, configErr *ConfigError) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		name, tagged := field.Tag.Lookup("env")
+		if field.Type.Kind() == reflect.Struct && !isTextUnmarshaler(fieldValue) && name != "-" {
+			applyEnvToStruct(fieldValue, prefix+name, configErr)
+			continue
+		}
+		if !tagged || name == "-" {
+			continue
+		}
+
+		raw, found := os.LookupEnv(prefix + name)
+		if !found {
+			continue
+		}
+		if err := setFromString(fieldValue, raw); err != nil {
+			configErr.add(prefix+name, err)
+		}
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func isTextUnmarshaler(value reflect.Value) bool {
+	_, ok := value.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+func setFromString(value reflect.Value, raw string) error {
+	if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(raw))
+	}
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		value.SetInt(int64(duration))
+		return err
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		items := splitList(raw)
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", value.Type().Key())
+		}
+		items := reflect.MakeMap(value.Type())
+		for _, item := range splitList(raw) {
+			key, itemValue, found := strings.Cut(item, "=")
+			if !found {
+				return fmt.Errorf("%q is not a key=value pair", item)
+			}
+			parsed := reflect.New(value.Type().Elem()).Elem()
+			if err := setFromString(parsed, strings.TrimSpace(itemValue)); err != nil {
+				return err
+			}
+			items.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)).Convert(value.Type().Key()), parsed)
+		}
+		value.Set(items)
+	default:
+		return errors.New("can't be set from an environment variable")
+	}
+	return nil
+}
+
+// splitList splits a comma separated environment value, ignoring empty items.
+func splitList(raw string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
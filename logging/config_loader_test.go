@@ -0,0 +1,178 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var expectedLoadedConfig = Config{
+	AppName:       appName,
+	LogsFolder:    "/var/log",
+	LogToJsonFile: true,
+	Level:         "info",
+	Colors:        true,
+	MaxSizeMB:     100,
+	MaxBackups:    3,
+	AdditionalFields: LoggerFields{
+		Dc:              "42",
+		ArtifactID:      "com.wixpress.artifact",
+		ArtifactVersion: "1.0.1",
+		Hostname:        "pod-1",
+	},
+}
+
+func Test_LoadConfigFileShouldSupportJsonYamlAndToml(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+			"app_name": "test-app", "logs_folder": "/var/log", "log_to_json_file": true,
+			"level": "info", "colors": true, "max_size_mb": 100, "max_backups": 3,
+			"additional_fields": {"artifact_id": "com.wixpress.artifact", "artifact_version": "1.0.1", "hostname": "pod-1", "dc": "42"}
+		}`,
+		"config.yaml": `
+app_name: test-app
+logs_folder: /var/log
+log_to_json_file: true
+level: info
+colors: true
+max_size_mb: 100
+max_backups: 3
+additional_fields:
+  artifact_id: com.wixpress.artifact
+  artifact_version: 1.0.1
+  hostname: pod-1
+  dc: "42"
+`,
+		"config.toml": `
+app_name = "test-app"
+logs_folder = "/var/log"
+log_to_json_file = true
+level = "info"
+colors = true
+max_size_mb = 100
+max_backups = 3
+
+[additional_fields]
+artifact_id = "com.wixpress.artifact"
+artifact_version = "1.0.1"
+hostname = "pod-1"
+dc = "42"
+`,
+	}
+
+	for name, content := range files {
+		config, err := LoadConfigFile(writeConfigFile(t, name, content))
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, expectedLoadedConfig, config, name)
+	}
+}
+
+func Test_LoadConfigFileShouldKeepDefaultsForMissingKeys(t *testing.T) {
+	config, err := LoadConfigFile(writeConfigFile(t, "config.yml", "app_name: test-app\n"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, appName, config.AppName)
+	assert.Equal(t, DefaultConfig().Level, config.Level)
+}
+
+func Test_LoadConfigFileShouldRejectUnknownKeys(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.json": `{"levle": "info"}`,
+		"config.yaml": "levle: info\n",
+		"config.toml": "levle = \"info\"\n",
+		"config.ini":  "level=info\n",
+	} {
+		_, err := LoadConfigFile(writeConfigFile(t, name, content))
+
+		assert.Error(t, err, name)
+	}
+}
+
+func Test_ConfigFromEnvShouldFillEveryField(t *testing.T) {
+	env := map[string]string{
+		"LOG_APP_NAME":         "test-app",
+		"LOG_LOGS_FOLDER":      "/var/log",
+		"LOG_LOG_TO_JSON_FILE": "true",
+		"LOG_LEVEL":            "info",
+		"LOG_COLORS":           "1",
+		"LOG_MAX_SIZE_MB":      "100",
+		"LOG_MAX_BACKUPS":      "3",
+		"LOG_ARTIFACT_ID":      "com.wixpress.artifact",
+		"LOG_ARTIFACT_VERSION": "1.0.1",
+		"LOG_HOSTNAME":         "pod-1",
+		"LOG_DC":               "42",
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	config, err := ConfigFromEnv("LOG")
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedLoadedConfig, config)
+}
+
+func Test_ConfigFromEnvShouldPrefixTaggedNestedStructs(t *testing.T) {
+	t.Setenv("LOG_ROTATION_MAX_AGE_DAYS", "7")
+	t.Setenv("LOG_ERRORS_ROTATION_MAX_AGE_DAYS", "90")
+	t.Setenv("LOG_ERRORS_ROTATION_INTERVAL", "daily")
+
+	config, err := ConfigFromEnv("LOG")
+
+	assert.NoError(t, err)
+	assert.Equal(t, RotationPolicy{MaxAgeDays: 7}, config.Rotation)
+	assert.Equal(t, RotationPolicy{MaxAgeDays: 90, Interval: RotateDaily}, config.ErrorsRotation)
+}
+
+func Test_ConfigFromEnvShouldReportUnparsableValues(t *testing.T) {
+	t.Setenv("LOG_COLORS", "sometimes")
+	t.Setenv("LOG_MAX_BACKUPS", "many")
+
+	_, err := ConfigFromEnv("LOG_")
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, []string{"LOG_COLORS", "LOG_MAX_BACKUPS"}, problemFields(configErr))
+}
+
+func Test_LoadConfigShouldApplyEnvOverFileOverDefaults(t *testing.T) {
+	fileName := writeConfigFile(t, "config.yaml", "level: info\napp_name: from-file\n")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	config, err := LoadConfig(fileName, "LOG")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", config.Level)
+	assert.Equal(t, "from-file", config.AppName)
+	assert.Equal(t, DefaultConfig().Colors, config.Colors)
+}
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	fileName := path.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(fileName, []byte(content), 0644))
+	return fileName
+}
+
+func Test_LoadConfigFileShouldReadSinks(t *testing.T) {
+	fileName := writeConfigFile(t, "config.yaml", `
+level: debug
+sinks:
+  - destination: stdout
+    format: console
+    level: info
+  - destination: stderr
+    format: text
+    level: error
+`)
+
+	config, err := LoadConfigFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, []SinkConfig{
+		{Destination: DestinationStdout, Format: FormatConsole, Level: "info"},
+		{Destination: DestinationStderr, Format: FormatText, Level: "error"},
+	}, config.Sinks)
+}
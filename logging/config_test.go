@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidConfigShouldPassValidation(t *testing.T) {
+	config := Config{
+		AppName:       appName,
+		LogsFolder:    t.TempDir(),
+		LogToJsonFile: true,
+		Level:         "info",
+		AdditionalFields: LoggerFields{
+			Dc:              "42",
+			ArtifactID:      "com.wixpress.artifact",
+			ArtifactVersion: "1.0.1",
+			Hostname:        "pod-1",
+		},
+	}
+
+	assert.NoError(t, config.Validate())
+}
+
+func Test_ValidateShouldReportAllProblemsAtOnce(t *testing.T) {
+	config := Config{
+		AppName:       "app/name",
+		LogsFolder:    path.Join(t.TempDir(), "missing"),
+		LogToJsonFile: true,
+		Level:         "loud",
+		AdditionalFields: LoggerFields{
+			Hostname: "pod-1\n",
+		},
+	}
+
+	err := config.Validate()
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, []string{"Level", "AppName", "LogsFolder", "AdditionalFields.Hostname"}, problemFields(configErr))
+	assert.True(t, errors.Is(configErr.Problems[2], os.ErrNotExist))
+}
+
+func Test_ValidateShouldRejectAFileAsLogsFolder(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(fileName, nil, 0644))
+
+	err := Config{Level: "info", AppName: appName, LogsFolder: fileName, LogToJsonFile: true}.Validate()
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, []string{"LogsFolder"}, problemFields(configErr))
+}
+
+func Test_ValidateShouldIgnoreFileSettingsWhenNotLoggingToJsonFile(t *testing.T) {
+	assert.NoError(t, Config{Level: "info", LogsFolder: "/does/not/exist"}.Validate())
+}
+
+func Test_SetLogConfigEShouldKeepCurrentConfigOnError(t *testing.T) {
+	assert.NoError(t, SetLogConfigE(Config{Level: "warn"}))
+
+	err := SetLogConfigE(Config{Level: "loud"})
+
+	assert.Error(t, err)
+	assert.Equal(t, logrus.WarnLevel, GetLog("test").Logger.Level)
+	assert.NoError(t, SetLogConfigE(Config{Level: "debug"}))
+}
+
+func Test_SetLogConfigShouldPanicOnInvalidConfig(t *testing.T) {
+	assert.Panics(t, func() {
+		SetLogConfig(Config{Level: "loud"})
+	})
+}
+
+func problemFields(configErr *ConfigError) []string {
+	fields := make([]string, len(configErr.Problems))
+	for i, problem := range configErr.Problems {
+		fields[i] = problem.Field
+	}
+	return fields
+}
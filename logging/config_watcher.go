@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConfigWatcher reloads a Logger when its config file changes or when the
+// process receives SIGHUP.
+type ConfigWatcher struct {
+	logger    *Logger
+	fileName  string
+	envPrefix string
+	signals   chan os.Signal
+	stop      chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+	modTime   time.Time
+	size      int64
+}
+
+// WatchConfigFile reloads the Logger with LoadConfig(fileName, envPrefix) when
+// the file changes, checked every interval, and on SIGHUP. An interval <= 0
+// disables polling. Failed reloads are logged and keep the current configuration.
+func (l *Logger) WatchConfigFile(fileName string, envPrefix string, interval time.Duration) *ConfigWatcher {
+	w := &ConfigWatcher{
+		logger:    l,
+		fileName:  fileName,
+		envPrefix: envPrefix,
+		signals:   make(chan os.Signal, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	w.changed()
+	signal.Notify(w.signals, syscall.SIGHUP)
+
+	go w.run(interval)
+
+	return w
+}
+
+// WatchConfigFile watches the config file of the default Logger, see
+// Logger.WatchConfigFile.
+func WatchConfigFile(fileName string, envPrefix string, interval time.Duration) *ConfigWatcher {
+	return std.WatchConfigFile(fileName, envPrefix, interval)
+}
+
+// Stop stops watching and waits for a reload in progress to finish.
+func (w *ConfigWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *ConfigWatcher) run(interval time.Duration) {
+	defer close(w.done)
+	defer signal.Stop(w.signals)
+
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.signals:
+			w.changed()
+			w.reload()
+		case <-ticks:
+			if w.changed() {
+				w.reload()
+			}
+		}
+	}
+}
+
+// changed reports whether the file was modified since the last check.
+func (w *ConfigWatcher) changed() bool {
+	info, err := os.Stat(w.fileName)
+	if err != nil {
+		return false
+	}
+
+	changed := !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	return changed
+}
+
+func (w *ConfigWatcher) reload() {
+	config, err := LoadConfig(w.fileName, w.envPrefix)
+	if err == nil {
+		err = w.logger.Reload(config)
+	}
+	if err != nil {
+		w.logger.GetLog("logging").Error("Failed to reload logging config: ", err)
+	}
+}
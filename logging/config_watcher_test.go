@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReloadShouldAddSinksAndLogAnAuditEntry(t *testing.T) {
+	folder := t.TempDir()
+	logger, err := New(Config{Level: "info", AppName: appName, LogsFolder: folder})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	err = logger.Reload(Config{Level: "debug", AppName: appName, LogsFolder: folder, LogToJsonFile: true})
+
+	assert.NoError(t, err)
+	entries := loadLogFile(path.Join(folder, appName+"_logstash_json.log"))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "Logging configuration reloaded", entries[0]["message"])
+	changes := entries[0]["data"].(map[string]interface{})["changes"]
+	assert.Len(t, changes, 2)
+	assert.Contains(t, changes, `level "info" -> "debug"`)
+}
+
+func Test_ReloadShouldKeepUnchangedSinksAndSwapTheirLevel(t *testing.T) {
+	config := Config{Level: "debug", AppName: appName, LogsFolder: t.TempDir(), LogToJsonFile: true}
+	logger, err := New(config)
+	assert.NoError(t, err)
+	defer logger.Close()
+	hook := logger.sinks[sinkSpecs(config, logrus.DebugLevel)[0].key].hook
+
+	config.Level = "warn"
+	assert.NoError(t, logger.Reload(config))
+
+	assert.Len(t, logger.sinks, 1)
+	assert.Same(t, hook, logger.sinks[sinkSpecs(config, logrus.WarnLevel)[0].key].hook)
+	assert.Equal(t, logrus.WarnLevel, hook.Level())
+	assert.Equal(t, logrus.WarnLevel, logger.logger.GetLevel())
+}
+
+func Test_ReloadShouldKeepCurrentConfigWhenInvalid(t *testing.T) {
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+
+	assert.Error(t, logger.Reload(Config{Level: "loud"}))
+	assert.Equal(t, logrus.InfoLevel, logger.logger.GetLevel())
+}
+
+func Test_ReloadWhileLoggingShouldBeSafe(t *testing.T) {
+	folder := t.TempDir()
+	logger, err := New(Config{Level: "info", AppName: appName, LogsFolder: folder, LogToJsonFile: true})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.GetLog("test").Info("Test")
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, logger.Reload(Config{Level: "info", AppName: appName, LogsFolder: folder, LogToJsonFile: i%2 == 0}))
+	}
+	wg.Wait()
+}
+
+func Test_WatchConfigFileShouldReloadWhenTheFileChanges(t *testing.T) {
+	fileName := writeConfigFile(t, "config.yaml", "level: info\n")
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+
+	watcher := logger.WatchConfigFile(fileName, "", 10*time.Millisecond)
+	defer watcher.Stop()
+	assert.NoError(t, os.WriteFile(fileName, []byte("level: debug\n"), 0644))
+
+	assert.Eventually(t, func() bool {
+		return logger.logger.IsLevelEnabled(logrus.DebugLevel)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_WatchConfigFileShouldReloadOnSignal(t *testing.T) {
+	fileName := writeConfigFile(t, "config.yaml", "level: warn\n")
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+
+	watcher := logger.WatchConfigFile(fileName, "", 0)
+	defer watcher.Stop()
+	watcher.signals <- syscall.SIGHUP
+
+	assert.Eventually(t, func() bool {
+		return logger.logger.GetLevel() == logrus.WarnLevel
+	}, time.Second, 10*time.Millisecond)
+}
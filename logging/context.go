@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+type traceContextKey struct{}
+type segmentContextKey struct{}
+
+// traceContextFields are the fields of a Trace or Segment added to the entries
+// logged with a context carrying it.
+var traceContextFields = []string{FieldNameTraceId, FieldNameAction, FieldNameSegment, FieldNameSegmentId, FieldNameParentSegmentId}
+
+// ContextWithTrace returns a copy of ctx carrying the trace, so that it doesn't
+// have to be passed by hand through every function. See TraceFromContext and
+// GetLogCtx. The entries logged with it are held by the tail buffer of the
+// trace, if any, like the entries of the trace itself.
+func ContextWithTrace(ctx context.Context, trace Trace) context.Context {
+	ctx = context.WithValue(contextOrBackground(ctx), traceContextKey{}, trace)
+	if buffer := tailBufferOfTrace(trace); buffer != nil {
+		ctx = withTailBuffer(ctx, buffer)
+	}
+	return ctx
+}
+
+func tailBufferOfTrace(t Trace) *tailBuffer {
+	if t, ok := t.(*trace); ok {
+		return t.tail
+	}
+	return nil
+}
+
+// ContextWithSegment returns a copy of ctx carrying the segment and its trace.
+// See SegmentFromContext.
+func ContextWithSegment(ctx context.Context, segment Segment) context.Context {
+	ctx = ContextWithTrace(ctx, segment.Parent())
+	return context.WithValue(ctx, segmentContextKey{}, segment)
+}
+
+// TraceFromContext returns the trace carried by ctx.
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	trace, ok := ctx.Value(traceContextKey{}).(Trace)
+	return trace, ok
+}
+
+// SegmentFromContext returns the segment carried by ctx, i.e. the last one
+// started by Trace.StartSegmentCtx.
+func SegmentFromContext(ctx context.Context) (Segment, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	segment, ok := ctx.Value(segmentContextKey{}).(Segment)
+	return segment, ok
+}
+
+// GetLogCtx returns an entry tagged with the given obj field, with the context
+// and the trace fields of ctx: trace_id, action and segment when it carries a
+// trace or a segment.
+func (l *Logger) GetLogCtx(ctx context.Context, obj string) *logrus.Entry {
+	entry := l.GetLog(obj)
+	if ctx == nil {
+		return entry
+	}
+	return entry.WithContext(ctx).WithFields(traceFields(ctx))
+}
+
+// GetLogCtx returns an entry of the default Logger, see Logger.GetLogCtx.
+func GetLogCtx(ctx context.Context, obj string) *logrus.Entry {
+	return std.GetLogCtx(ctx, obj)
+}
+
+// traceFields returns the trace fields of the segment or the trace carried by
+// ctx.
+func traceFields(ctx context.Context) logrus.Fields {
+	var entry *logrus.Entry
+	if segment, ok := SegmentFromContext(ctx); ok {
+		entry = segment.Log()
+	} else if trace, ok := TraceFromContext(ctx); ok {
+		entry = trace.Log()
+	} else {
+		return nil
+	}
+
+	retVal := make(logrus.Fields, len(traceContextFields))
+	for _, field := range traceContextFields {
+		if value, found := entry.Data[field]; found {
+			retVal[field] = value
+		}
+	}
+	return retVal
+}
+
+// addTraceFields adds the trace fields of the context of the entry to its
+// fields, unless already set.
+func addTraceFields(entry *logrus.Entry) {
+	if entry.Context == nil {
+		return
+	}
+	for field, value := range traceFields(entry.Context) {
+		if _, found := entry.Data[field]; !found {
+			entry.Data[field] = value
+		}
+	}
+}
+
+// TraceContextHook adds the trace fields of the trace or segment carried by the
+// context of an entry, like GetLogCtx does, to the entries of any logrus
+// logger:
+//
+//	logrus.AddHook(logging.TraceContextHook{})
+//	logrus.WithContext(ctx).Info("Charged")
+//
+// The entries of a Logger get them without the hook.
+type TraceContextHook struct{}
+
+func (TraceContextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (TraceContextHook) Fire(entry *logrus.Entry) error {
+	addTraceFields(entry)
+	return nil
+}
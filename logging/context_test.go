@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StartSegmentCtxShouldCarryTheTraceAndTheSegment(t *testing.T) {
+	_, entry := newTestLogger()
+	trace := NewTrace("checkout", entry)
+
+	ctx, segment := trace.StartSegmentCtx(context.Background(), "pay")
+
+	fromContext, ok := TraceFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, trace, fromContext)
+	segmentFromContext, ok := SegmentFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, segment, segmentFromContext)
+
+	_, ok = SegmentFromContext(ContextWithTrace(context.Background(), trace))
+	assert.False(t, ok)
+	_, ok = TraceFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func Test_GetLogCtxShouldAddTheTraceFields(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info"})
+	trace := logger.NewTrace("checkout")
+
+	logger.GetLogCtx(ContextWithTrace(context.Background(), trace), "db").Info("in the trace")
+	assert.Equal(t, map[string]string{"level": "info", "msg": "in the trace", "obj": "db", "trace_id": trace.Id(), "action": "checkout"},
+		withoutTime(console.last()))
+
+	ctx, _ := trace.StartSegmentCtx(context.Background(), "pay")
+	logger.GetLogCtx(ctx, "db").Info("in the segment")
+	assert.Equal(t, "pay", console.last()[FieldNameSegment])
+	assert.Equal(t, trace.Id(), console.last()[FieldNameTraceId])
+
+	logger.GetLogCtx(context.Background(), "db").Info("outside")
+	assert.Equal(t, map[string]string{"level": "info", "msg": "outside", "obj": "db"}, withoutTime(console.last()))
+}
+
+func Test_EntriesWithATraceContextShouldGetTheTraceFields(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info"})
+	ctx, _ := logger.NewTrace("checkout").StartSegmentCtx(context.Background(), "pay")
+
+	logger.GetLog("db").WithContext(ctx).Info("with context")
+	assert.Equal(t, "pay", console.last()[FieldNameSegment])
+
+	logger.GetLog("db").WithContext(ctx).WithField(FieldNameSegment, "explicit").Info("overridden")
+	assert.Equal(t, "explicit", console.last()[FieldNameSegment])
+}
+
+func Test_TraceContextHookShouldEnrichEntriesOfAnyLogrusLogger(t *testing.T) {
+	_, entry := newTestLogger()
+	trace := NewTrace("checkout", entry)
+	ctx, segment := trace.StartSegmentCtx(context.Background(), "pay")
+
+	other, hook := test.NewNullLogger()
+	other.AddHook(TraceContextHook{})
+	other.WithContext(ctx).Info("enriched")
+	other.Info("plain")
+
+	entries := hook.AllEntries()
+	assert.Equal(t, logrus.Fields{
+		FieldNameTraceId:   trace.Id(),
+		FieldNameAction:    "checkout",
+		FieldNameSegment:   "pay",
+		FieldNameSegmentId: segment.Id(),
+	}, entries[0].Data)
+	assert.Empty(t, entries[1].Data)
+}
+
+func Test_TailBufferShouldHoldTheDebugEntriesOfATraceContext(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", TailBuffer: TailBufferConfig{Size: 10}})
+
+	ctx, segment := logger.NewTrace("checkout").StartSegmentCtx(context.Background(), "pay")
+	logger.GetLogCtx(ctx, "bank").Debug("calling the bank")
+	assert.Equal(t, []string{""}, console.messages())
+
+	segment.EndWithErrorIf(errors.New("declined"))
+	assert.Equal(t, []string{"", "calling the bank", "declined"}, console.messages())
+	assert.Equal(t, "bank", console.entries[1][FieldNameObj])
+}
+
+func withoutTime(entry map[string]string) map[string]string {
+	delete(entry, "time")
+	return entry
+}
@@ -0,0 +1,216 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The fields of the entry closing a run of duplicates: how many duplicates
+// were collapsed, and when the first and the last entry of the run were logged.
+const (
+	FieldNameRepeatCount = "repeat_count"
+	FieldNameFirstSeen   = "first_seen"
+	FieldNameLastSeen    = "last_seen"
+)
+
+const defaultDedupMaxDuration = time.Minute
+
+// DedupConfig collapses identical entries: the same level, obj, message and
+// Fields values. The first entry of a run is logged right away and the
+// duplicates following it within Window of each other are dropped. Once no
+// duplicate came for Window, or the run lasted MaxDuration, an entry with the
+// message and fields of the first one closes it, with FieldNameRepeatCount,
+// FieldNameFirstSeen and FieldNameLastSeen:
+//
+//	{"window": "1s", "fields": ["error"]}
+//
+// Fatal and panic entries are never collapsed.
+type DedupConfig struct {
+	// Window enables deduplication when set, e.g. "1s".
+	Window string `json:"window" yaml:"window" toml:"window" env:"WINDOW"`
+	// MaxDuration defaults to 1m.
+	MaxDuration string `json:"max_duration" yaml:"max_duration" toml:"max_duration" env:"MAX_DURATION"`
+	// Fields are the fields whose values must be equal too, e.g. "error".
+	Fields []string `json:"fields" yaml:"fields" toml:"fields" env:"FIELDS"`
+}
+
+func (config DedupConfig) validate(field string, configErr *ConfigError) {
+	durations := []struct{ name, value string }{
+		{"Window", config.Window},
+		{"MaxDuration", config.MaxDuration},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		if parsed, err := time.ParseDuration(duration.value); err != nil {
+			configErr.add(field+"."+duration.name, err)
+		} else if parsed <= 0 {
+			configErr.add(field+"."+duration.name, fmt.Errorf("%s is not positive", duration.value))
+		}
+	}
+}
+
+func (config DedupConfig) copy() DedupConfig {
+	config.Fields = append([]string(nil), config.Fields...)
+	return config
+}
+
+// deduper applies a DedupConfig to entries. The entries closing the runs of
+// duplicates are logged through logger.
+type deduper struct {
+	logger      *logrus.Logger
+	window      time.Duration
+	maxDuration time.Duration
+	fields      []string
+	now         func() time.Time
+	afterFunc   func(d time.Duration, f func()) dedupTimer
+
+	lock sync.Mutex
+	runs map[string]*dedupRun
+}
+
+// dedupTimer closes a run, a *time.Timer unless the clock is replaced.
+type dedupTimer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// dedupRun is a run of duplicates of first. started and lastSeen are read from
+// the clock of the deduper, and lastTime is the time of the last duplicate.
+type dedupRun struct {
+	first    *logrus.Entry
+	repeats  int
+	started  time.Time
+	lastSeen time.Time
+	lastTime time.Time
+	timer    dedupTimer
+}
+
+// newDeduper returns the deduper of config, or nil when config collapses
+// nothing.
+func newDeduper(config DedupConfig, logger *logrus.Logger) *deduper {
+	if config.Window == "" {
+		return nil
+	}
+
+	retVal := &deduper{
+		logger:      logger,
+		maxDuration: defaultDedupMaxDuration,
+		fields:      config.Fields,
+		now:         time.Now,
+		afterFunc: func(d time.Duration, f func()) dedupTimer {
+			return time.AfterFunc(d, f)
+		},
+		runs: make(map[string]*dedupRun),
+	}
+	retVal.window, _ = time.ParseDuration(config.Window)
+	if config.MaxDuration != "" {
+		retVal.maxDuration, _ = time.ParseDuration(config.MaxDuration)
+	}
+	return retVal
+}
+
+// allows reports whether the entry is logged, i.e. it doesn't repeat the
+// previous one of its run.
+func (d *deduper) allows(entry *logrus.Entry) bool {
+	if entry.Level <= logrus.FatalLevel {
+		return true
+	}
+
+	key := d.key(entry)
+	now := d.now()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	run := d.runs[key]
+	if run == nil {
+		first := entry.Dup()
+		first.Level = entry.Level
+		first.Message = entry.Message
+		first.Time = entryTime(entry, now)
+		run = &dedupRun{first: first, started: now, lastSeen: now}
+		d.runs[key] = run
+		run.timer = d.afterFunc(d.window, func() {
+			d.close(key, run)
+		})
+		return true
+	}
+
+	run.repeats++
+	run.lastSeen = now
+	run.lastTime = entryTime(entry, now)
+	return false
+}
+
+// entryTime returns the time the entry was logged, which may be long before it
+// is fired, e.g. for the entries replayed by a tail buffer.
+func entryTime(entry *logrus.Entry, now time.Time) time.Time {
+	if entry.Time.IsZero() {
+		return now
+	}
+	return entry.Time
+}
+
+func (d *deduper) key(entry *logrus.Entry) string {
+	obj, _ := entry.Data[FieldNameObj].(string)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d\x00%s\x00%s", entry.Level, obj, entry.Message)
+	for _, field := range d.fields {
+		fmt.Fprintf(&builder, "\x00%v", entry.Data[field])
+	}
+	return builder.String()
+}
+
+// close ends the run once no duplicate came for the window, or it lasted
+// maxDuration, and logs the entry closing it when it had duplicates.
+func (d *deduper) close(key string, run *dedupRun) {
+	d.lock.Lock()
+	now := d.now()
+	if end := run.lastSeen.Add(d.window); now.Before(end) && now.Sub(run.started) < d.maxDuration {
+		run.timer.Reset(end.Sub(now))
+		d.lock.Unlock()
+		return
+	}
+	if d.runs[key] == run {
+		delete(d.runs, key)
+	}
+	d.lock.Unlock()
+
+	d.report(run)
+}
+
+func (d *deduper) report(run *dedupRun) {
+	if run.repeats == 0 {
+		return
+	}
+	closing := logrus.NewEntry(d.logger).WithContext(bypassStages(run.first.Context)).WithFields(run.first.Data).WithFields(logrus.Fields{
+		FieldNameRepeatCount: run.repeats,
+		FieldNameFirstSeen:   run.first.Time.Format(TimestampFormat),
+		FieldNameLastSeen:    run.lastTime.Format(TimestampFormat),
+	})
+	closing.Log(run.first.Level, run.first.Message)
+}
+
+// flush closes the runs that haven't ended yet.
+func (d *deduper) flush() {
+	d.lock.Lock()
+	runs := make([]*dedupRun, 0, len(d.runs))
+	for key, run := range d.runs {
+		if run.timer.Stop() {
+			runs = append(runs, run)
+			delete(d.runs, key)
+		}
+	}
+	d.lock.Unlock()
+
+	for _, run := range runs {
+		d.report(run)
+	}
+}
@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DedupShouldCollapseIdenticalEntriesOnConsoleAndJsonFile(t *testing.T) {
+	folder := t.TempDir()
+	logger, console := newJsonConsoleLogger(t, Config{
+		AppName:       appName,
+		LogsFolder:    folder,
+		LogToJsonFile: true,
+		Level:         "debug",
+		Dedup:         DedupConfig{Window: "1h"},
+	})
+
+	for i := 0; i < 5; i++ {
+		logger.GetLog("client").WithField("attempt", i).Error("downstream is down")
+	}
+	logger.GetLog("client").Error("another error")
+	assert.Equal(t, []string{"downstream is down", "another error"}, console.messages())
+
+	assert.NoError(t, logger.Flush())
+	closing := console.last()
+	assert.Equal(t, "downstream is down", closing["msg"])
+	assert.Equal(t, "4", closing[FieldNameRepeatCount])
+	assert.Equal(t, "0", closing["attempt"])
+	assert.NotEmpty(t, closing[FieldNameFirstSeen])
+	assert.NotEmpty(t, closing[FieldNameLastSeen])
+
+	entries := loadLogFile(path.Join(folder, fmt.Sprintf("%s_logstash_json.log", appName)))
+	assert.Len(t, entries, 4)
+	assert.Equal(t, "downstream is down", entries[3]["message"])
+	assert.Equal(t, float64(4), entries[3]["data"].(map[string]interface{})[FieldNameRepeatCount])
+}
+
+func Test_DedupShouldKeepEntriesWithDifferentSelectedFields(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{
+		Level: "debug",
+		Dedup: DedupConfig{Window: "1h", Fields: []string{"error"}},
+	})
+
+	logger.GetLog("client").WithError(errors.New("timeout")).Warn("call failed")
+	logger.GetLog("client").WithError(errors.New("refused")).Warn("call failed")
+	logger.GetLog("client").WithError(errors.New("timeout")).Warn("call failed")
+	logger.GetLog("server").WithError(errors.New("timeout")).Warn("call failed")
+
+	assert.Len(t, console.messages(), 3)
+}
+
+func Test_DedupShouldSlideTheWindowWithEachDuplicate(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{
+		Level: "debug",
+		Dedup: DedupConfig{Window: "100ms"},
+	})
+	clock := useFakeClock(logger)
+
+	for i := 0; i < 3; i++ {
+		logger.GetLog("client").Info("retrying")
+		clock.advance(60 * time.Millisecond)
+	}
+	assert.Len(t, console.messages(), 1)
+
+	clock.advance(100 * time.Millisecond)
+	assert.Equal(t, "2", console.last()[FieldNameRepeatCount])
+	logger.GetLog("client").Info("retrying")
+	assert.Len(t, console.messages(), 2)
+}
+
+func Test_DedupShouldCloseRunsAfterMaxDuration(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{
+		Level: "debug",
+		Dedup: DedupConfig{Window: "50ms", MaxDuration: "120ms"},
+	})
+	clock := useFakeClock(logger)
+
+	for i := 0; i < 14; i++ {
+		logger.GetLog("client").Info("busy")
+		clock.advance(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, []string{"busy", "busy"}, console.messages())
+	assert.Len(t, console.entries, 3)
+	assert.Equal(t, "12", console.entries[1][FieldNameRepeatCount])
+}
+
+func Test_DedupShouldReportWhenTheDuplicatesWereLogged(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{
+		Level: "debug",
+		Dedup: DedupConfig{Window: "1h"},
+	})
+	logged := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	logger.GetLog("client").WithTime(logged).Info("retrying")
+	logger.GetLog("client").WithTime(logged.Add(time.Second)).Info("retrying")
+	logger.GetLog("client").WithTime(logged.Add(2 * time.Second)).Info("retrying")
+	assert.NoError(t, logger.Flush())
+
+	assert.Equal(t, logged.Format(TimestampFormat), console.last()[FieldNameFirstSeen])
+	assert.Equal(t, logged.Add(2*time.Second).Format(TimestampFormat), console.last()[FieldNameLastSeen])
+}
+
+func Test_DedupShouldBeValidated(t *testing.T) {
+	config := Config{Level: "info", Dedup: DedupConfig{Window: "soon", MaxDuration: "-1s"}}
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(config.Validate(), &configErr))
+	assert.Len(t, configErr.Problems, 2)
+	assert.Equal(t, "Dedup.Window", configErr.Problems[0].Field)
+	assert.Equal(t, "Dedup.MaxDuration", configErr.Problems[1].Field)
+}
+
+// fakeClock replaces the clock of the deduper of a Logger. Its timers fire
+// from advance, once the time reaches them.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	at     time.Time
+	f      func()
+	active bool
+}
+
+func useFakeClock(logger *Logger) *fakeClock {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	deduper := logger.dispatcher.stages.deduper
+	deduper.now = clock.Now
+	deduper.afterFunc = clock.AfterFunc
+	return clock
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) dedupTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), f: f, active: true}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// advance moves the time forward by d, firing the timers due on the way in
+// order.
+func (c *fakeClock) advance(d time.Duration) {
+	c.lock.Lock()
+	target := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for _, timer := range c.timers {
+			if timer.active && !timer.at.After(target) && (next == nil || timer.at.Before(next.at)) {
+				next = timer
+			}
+		}
+		if next == nil {
+			break
+		}
+		c.now = next.at
+		next.active = false
+		c.lock.Unlock()
+		next.f()
+		c.lock.Lock()
+	}
+	c.now = target
+	c.lock.Unlock()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	t.at = t.clock.now.Add(d)
+	t.active = true
+	return active
+}
@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"context"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// dispatcher is the single logrus hook registered by a Logger. It passes
+// entries through its stages and fans them out to the Logger's sinks, all of
+// which can be replaced while entries are in flight. As logrus writes the entry
+// it fired the hooks with, the console output goes through the stages too.
+type dispatcher struct {
+	lock   sync.RWMutex
+	hooks  []levelSink
+	stages stages
+}
+
+// stages are the steps an entry goes through before reaching the sinks. Each
+// is nil when not configured.
+type stages struct {
+	objLevels *objLevels
+	deduper   *deduper
+	sampler   *sampler
+	redactor  *redactor
+}
+
+// stageMark marks an entry in its context for the stages.
+type stageMark int
+
+const (
+	// markSuppressed is set on the entries a stage dropped, so the console
+	// skips them too.
+	markSuppressed stageMark = iota
+	// markBypass is set on the entries logged by the stages themselves, e.g.
+	// the reports of sampled out entries or the entries held by the tail buffer
+	// of a failed trace, which must not be filtered, deduplicated or sampled
+	// again.
+	markBypass
+)
+
+// bypassStages returns ctx marked so that its entries skip the obj levels,
+// dedup and sampling stages.
+func bypassStages(ctx context.Context) context.Context {
+	return context.WithValue(contextOrBackground(ctx), markBypass, true)
+}
+
+func isMarked(entry *logrus.Entry, mark stageMark) bool {
+	return entry.Context != nil && entry.Context.Value(mark) != nil
+}
+
+func (d *dispatcher) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire passes the entry to every sink, even when one of them fails, and returns
+// the first error.
+func (d *dispatcher) Fire(entry *logrus.Entry) (retVal error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	addTraceFields(entry)
+	reportExternalCaller(entry)
+	bypass := isMarked(entry, markBypass)
+	if !bypass && d.stages.objLevels != nil && !d.stages.objLevels.allows(entry) {
+		buffer := tailBufferOf(entry)
+		if buffer == nil || !buffer.keeps(entry.Level) || buffer.hold(entry) {
+			suppress(entry)
+			return nil
+		}
+		// The trace failed, its debug entries are logged right away.
+		entry.Context = bypassStages(entry.Context)
+		bypass = true
+	}
+	if !bypass && !d.stages.allows(entry) {
+		suppress(entry)
+		return nil
+	}
+	if d.stages.redactor != nil {
+		d.stages.redactor.redact(entry)
+	}
+	for _, hook := range d.hooks {
+		if err := hook.Fire(entry); err != nil && retVal == nil {
+			retVal = err
+		}
+	}
+	return retVal
+}
+
+// packageDir is the directory of this package's sources, as recorded in the
+// binary.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return path.Dir(file)
+}()
+
+const maxCallerDepth = 32
+
+// reportExternalCaller replaces the caller of an entry logged by this package,
+// e.g. a segment marker or an entry of the HTTP middleware, with the first
+// frame outside of it and logrus. The caller is kept when there is none.
+func reportExternalCaller(entry *logrus.Entry) {
+	if entry.Caller == nil || !inPackage(entry.Caller.File) {
+		return
+	}
+	pcs := make([]uintptr, maxCallerDepth)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !inPackage(frame.File) && !strings.HasPrefix(frame.Function, "github.com/sirupsen/logrus.") {
+			entry.Caller = &frame
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// inPackage reports whether file is one of this package's sources, which its
+// tests are not.
+func inPackage(file string) bool {
+	return path.Dir(file) == packageDir && !strings.HasSuffix(file, "_test.go")
+}
+
+// suppress marks the entry as dropped by a stage.
+func suppress(entry *logrus.Entry) {
+	entry.Context = context.WithValue(contextOrBackground(entry.Context), markSuppressed, true)
+}
+
+// allows reports whether the console writes the entry, once it was fired.
+func (d *dispatcher) allows(entry *logrus.Entry) bool {
+	if isMarked(entry, markSuppressed) {
+		return false
+	}
+	if isMarked(entry, markBypass) {
+		return true
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.stages.objLevels == nil || d.stages.objLevels.allows(entry)
+}
+
+// swap waits for the entries being fired to be written, replaces the sinks and
+// stages and runs apply before any new entry is fired, so all changes are seen
+// together.
+func (d *dispatcher) swap(hooks []levelSink, stages stages, apply func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.hooks = hooks
+	d.stages = stages
+	apply()
+}
+
+// flush reports the entries the stages are holding back.
+func (d *dispatcher) flush() {
+	d.lock.RLock()
+	stages := d.stages
+	d.lock.RUnlock()
+
+	stages.flush()
+}
+
+// allows reports whether the dedup and sampling stages let the entry through.
+func (s stages) allows(entry *logrus.Entry) bool {
+	if s.deduper != nil && !s.deduper.allows(entry) {
+		return false
+	}
+	return s.sampler == nil || s.sampler.allows(entry)
+}
+
+// flush logs the entries the stages are holding back.
+func (s stages) flush() {
+	if s.deduper != nil {
+		s.deduper.flush()
+	}
+	if s.sampler != nil {
+		s.sampler.flush()
+	}
+}
+
+func contextOrBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
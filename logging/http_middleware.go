@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+const (
+	FieldNameHTTPMethod = "http_method"
+	FieldNameHTTPPath   = "http_path"
+	FieldNameHTTPStatus = "http_status"
+	FieldNameHTTPBytes  = "http_bytes"
+	FieldNameRemoteAddr = "remote_addr"
+	FieldNameUserAgent  = "user_agent"
+)
+
+const (
+	defaultTraceIdHeader     = "X-Trace-Id"
+	defaultHTTPMiddlewareObj = "http"
+)
+
+// HTTPMiddlewareOptions configures HTTPMiddleware. Its zero value is ready to
+// use.
+type HTTPMiddlewareOptions struct {
+	// Logger logs the traces of the requests, the default Logger when nil.
+	Logger *Logger
+	// Propagator extracts the trace of the caller from the request headers,
+	// the W3C Trace Context then the B3 headers when nil.
+	Propagator Propagator
+	// Route returns the name of the route of a request, used as action of the
+	// trace and name of its segment. It defaults to the URL path, which is
+	// best replaced by the pattern of the route when the paths hold ids.
+	Route func(r *http.Request) string
+	// Obj is the obj field of the entries of the traces, "http" by default.
+	Obj string
+	// TraceIdHeader is the response header holding the trace id, "X-Trace-Id"
+	// by default. "-" leaves it out.
+	TraceIdHeader string
+}
+
+// HTTPMiddleware runs each request in a trace, continuing the one of the
+// caller when the headers carry it. The request context carries the trace and
+// a segment named after the route, see GetLogCtx, which logs the method, path,
+// remote address and user agent of the request, and once it ends the status
+// and the number of bytes of the response. The segment ends with an error on
+// 5xx statuses and on panics, which are recovered into a 500 response.
+func HTTPMiddleware(next http.Handler, opts HTTPMiddlewareOptions) http.Handler {
+	logger := opts.Logger
+	if logger == nil {
+		logger = std
+	}
+	propagator := opts.Propagator
+	if propagator == nil {
+		propagator = CompositePropagator{W3CPropagator{}, B3SinglePropagator{}, B3MultiPropagator{}}
+	}
+	route := opts.Route
+	if route == nil {
+		route = func(r *http.Request) string { return r.URL.Path }
+	}
+	obj := opts.Obj
+	if obj == "" {
+		obj = defaultHTTPMiddlewareObj
+	}
+	traceIdHeader := opts.TraceIdHeader
+	if traceIdHeader == "" {
+		traceIdHeader = defaultTraceIdHeader
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := route(r)
+		trace := logger.ExtractTrace(propagator, name, r.Header).AddField(FieldNameObj, obj)
+		if traceIdHeader != "-" {
+			w.Header().Set(traceIdHeader, trace.Id())
+		}
+		segment := trace.NewSegment().
+			WithFields(map[string]interface{}{
+				FieldNameHTTPMethod: r.Method,
+				FieldNameHTTPPath:   r.URL.Path,
+				FieldNameRemoteAddr: r.RemoteAddr,
+				FieldNameUserAgent:  r.UserAgent(),
+			}).
+			Start(name)
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		defer trace.Finish()
+		defer func() {
+			recovered := recover()
+
+			var err error
+			switch {
+			case recovered == http.ErrAbortHandler:
+				// The server aborts the response once the segment ended.
+				err = http.ErrAbortHandler
+				defer panic(recovered)
+			case recovered != nil:
+				err = fmt.Errorf("panic: %v", recovered)
+				if recorder.status == 0 {
+					http.Error(recorder, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}
+			if recorder.status == 0 && err == nil {
+				recorder.status = http.StatusOK
+			}
+			if err == nil && recorder.status >= http.StatusInternalServerError {
+				err = fmt.Errorf("%d %s", recorder.status, http.StatusText(recorder.status))
+			}
+
+			if recorder.status != 0 {
+				segment.AddField(FieldNameHTTPStatus, recorder.status)
+			}
+			segment.AddField(FieldNameHTTPBytes, recorder.bytes).
+				EndWithErrorIf(err)
+		}()
+
+		next.ServeHTTP(recorder, r.WithContext(ContextWithSegment(r.Context(), segment)))
+	})
+}
+
+// responseRecorder records the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	// The informational statuses precede the one of the response.
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not an http.Hijacker", w.ResponseWriter)
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the ResponseWriter of the handler, for http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
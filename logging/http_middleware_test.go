@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HTTPMiddlewareShouldRunEachRequestInATrace(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info"})
+	handler := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.GetLogCtx(r.Context(), "orders").Info("listing")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}), HTTPMiddlewareOptions{
+		Logger: logger,
+		Route:  func(*http.Request) string { return "/orders/{id}" },
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/orders/1", nil)
+	request.Header.Set("User-Agent", "tests")
+	request.Header.Set("Traceparent", "00-"+testTraceId+"-"+testParentId+"-01")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, testTraceId, response.Header().Get("X-Trace-Id"))
+	assert.Equal(t, []string{"", "listing", ""}, console.messages())
+
+	start, logged, end := console.entries[0], console.entries[1], console.entries[2]
+	assert.Equal(t, MarkerStart, start[FieldNameMarker])
+	assert.Equal(t, "/orders/{id}", start[FieldNameSegment])
+	assert.Equal(t, "/orders/{id}", start[FieldNameAction])
+	assert.Equal(t, "http", start[FieldNameObj])
+	assert.Equal(t, testParentId, start[FieldNameParentSegmentId])
+	assert.Equal(t, http.MethodPost, start[FieldNameHTTPMethod])
+	assert.Equal(t, "/orders/1", start[FieldNameHTTPPath])
+	assert.Equal(t, "192.0.2.1:1234", start[FieldNameRemoteAddr])
+	assert.Equal(t, "tests", start[FieldNameUserAgent])
+
+	assert.Equal(t, "orders", logged[FieldNameObj])
+	assert.Equal(t, testTraceId, logged[FieldNameTraceId])
+	assert.Equal(t, start[FieldNameSegmentId], logged[FieldNameSegmentId])
+
+	assert.Equal(t, MarkerEnd, end[FieldNameMarker])
+	assert.Equal(t, "info", end["level"])
+	assert.Equal(t, "201", end[FieldNameHTTPStatus])
+	assert.Equal(t, "5", end[FieldNameHTTPBytes])
+}
+
+func Test_HTTPMiddlewareEntriesShouldReportTheCallerOfTheMiddleware(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", ReportCaller: true})
+	handler := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), HTTPMiddlewareOptions{Logger: logger})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Len(t, console.entries, 2)
+	for _, entry := range console.entries {
+		// The middleware is a http.HandlerFunc.
+		assert.Contains(t, entry["file"], "net/http/server.go:")
+	}
+}
+
+func Test_HTTPMiddlewareShouldEndWithAnErrorOnServerErrors(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", TailBuffer: TailBufferConfig{Size: 10}})
+	handler := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.GetLogCtx(r.Context(), "db").Debug("querying")
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}), HTTPMiddlewareOptions{Logger: logger, TraceIdHeader: "-"})
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	assert.Empty(t, response.Header().Get("X-Trace-Id"))
+	assert.Equal(t, []string{"", "querying", "503 Service Unavailable"}, console.messages())
+	assert.Equal(t, "error", console.last()["level"])
+	assert.Equal(t, "503", console.last()[FieldNameHTTPStatus])
+	assert.Equal(t, "/orders", console.last()[FieldNameSegment])
+}
+
+func Test_HTTPMiddlewareShouldNotEchoInvalidTraceIds(t *testing.T) {
+	logger, _ := newJsonConsoleLogger(t, Config{Level: "info"})
+	handler := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		HTTPMiddlewareOptions{Logger: logger, Propagator: HeaderIdPropagator{Header: "X-Request-Id"}})
+
+	request := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	request.Header.Set("X-Request-Id", "<script>alert(1)</script>")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	assert.NotEmpty(t, response.Header().Get("X-Trace-Id"))
+	assert.NotContains(t, response.Header().Get("X-Trace-Id"), "script")
+}
+
+func Test_HTTPMiddlewareShouldRecoverPanics(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info"})
+	handler := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), HTTPMiddlewareOptions{Logger: logger, Propagator: HeaderIdPropagator{Header: "X-Request-Id"}})
+
+	request := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	request.Header.Set("X-Request-Id", "req-1")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Equal(t, "req-1", response.Header().Get("X-Trace-Id"))
+	assert.Equal(t, "panic: boom", console.last()["msg"])
+	assert.Equal(t, "error", console.last()["level"])
+	assert.Equal(t, "500", console.last()[FieldNameHTTPStatus])
+	assert.Equal(t, "req-1", console.last()[FieldNameTraceId])
+}
+
+func Test_HTTPMiddlewareShouldEndTheSegmentOfAbortedHandlersBeforePanicking(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", TailBuffer: TailBufferConfig{Size: 10}})
+	var trace Trace
+	handler := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace, _ = TraceFromContext(r.Context())
+		logger.GetLogCtx(r.Context(), "db").Debug("querying")
+		panic(http.ErrAbortHandler)
+	}), HTTPMiddlewareOptions{Logger: logger})
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+
+	assert.Equal(t, []string{"", "querying", http.ErrAbortHandler.Error()}, console.messages())
+	assert.Equal(t, "error", console.last()["level"])
+	assert.NotContains(t, console.last(), FieldNameHTTPStatus)
+	buffer := tailBufferOfTrace(trace)
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	assert.True(t, buffer.finished)
+}
@@ -0,0 +1,526 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPBodyFormat is how an HTTP sink lays out a batch of entries.
+type HTTPBodyFormat string
+
+const (
+	// BodyNdjson sends an entry per line, as application/x-ndjson.
+	BodyNdjson HTTPBodyFormat = "ndjson"
+	// BodyJsonArray sends a JSON array of the entries, as application/json.
+	BodyJsonArray HTTPBodyFormat = "json_array"
+)
+
+// FailurePolicy decides what an HTTP sink does with a batch the endpoint keeps
+// failing.
+type FailurePolicy string
+
+const (
+	// FailureDrop drops the batch once its retries are exhausted.
+	FailureDrop FailurePolicy = "drop"
+	// FailureSpool keeps the batch in the spool and retries it after the
+	// backoff for as long as it takes, while the spool fills up.
+	FailureSpool FailurePolicy = "spool"
+)
+
+const (
+	defaultHTTPBatchSize    = 500
+	defaultHTTPBatchSizeKB  = 1024
+	defaultHTTPMaxBatchAge  = time.Second
+	defaultHTTPMaxRetries   = 3
+	defaultHTTPTimeout      = 10 * time.Second
+	httpContentTypeNdjson   = "application/x-ndjson"
+	httpContentTypeJson     = "application/json"
+	httpContentEncodingGzip = "gzip"
+)
+
+// HTTPOptions configures a DestinationHTTP sink. The entries are POSTed in
+// batches to SinkConfig.URL once BatchSize entries or BatchSizeKB are waiting,
+// or the oldest entry waited MaxBatchAge:
+//
+//	{"destination": "http", "url": "https://logs.example.com/ingest",
+//	 "http": {"gzip": true, "headers": {"Authorization": "Bearer secret"}, "max_batch_age": "5s"}}
+//
+// Batches failing with a network error, a 5xx or a 429 status are retried
+// after the SinkConfig.Reconnect backoff, up to MaxRetries times, and then
+// handled by OnFailure. Batches failing with another status are dropped.
+type HTTPOptions struct {
+	// Body defaults to BodyNdjson.
+	Body    HTTPBodyFormat `json:"body" yaml:"body" toml:"body"`
+	Gzip    bool           `json:"gzip" yaml:"gzip" toml:"gzip"`
+	Headers HTTPHeaders    `json:"headers" yaml:"headers" toml:"headers"`
+	// BatchSize defaults to 500 entries.
+	BatchSize int `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
+	// BatchSizeKB defaults to 1024.
+	BatchSizeKB int `json:"batch_size_kb" yaml:"batch_size_kb" toml:"batch_size_kb"`
+	// MaxBatchAge defaults to 1s.
+	MaxBatchAge string `json:"max_batch_age" yaml:"max_batch_age" toml:"max_batch_age"`
+	// MaxRetries defaults to 3.
+	MaxRetries int `json:"max_retries" yaml:"max_retries" toml:"max_retries"`
+	// OnFailure defaults to FailureDrop.
+	OnFailure FailurePolicy `json:"on_failure" yaml:"on_failure" toml:"on_failure"`
+	// Timeout of each request, defaults to 10s.
+	Timeout string `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+func (options HTTPOptions) validate(field string, configErr *ConfigError) {
+	switch options.Body {
+	case "", BodyNdjson, BodyJsonArray:
+	default:
+		configErr.add(field+".Body", fmt.Errorf("unknown body format %q", options.Body))
+	}
+	switch options.OnFailure {
+	case "", FailureDrop, FailureSpool:
+	default:
+		configErr.add(field+".OnFailure", fmt.Errorf("unknown failure policy %q", options.OnFailure))
+	}
+
+	counts := []struct {
+		name  string
+		value int
+	}{
+		{"BatchSize", options.BatchSize},
+		{"BatchSizeKB", options.BatchSizeKB},
+		{"MaxRetries", options.MaxRetries},
+	}
+	for _, count := range counts {
+		if count.value < 0 {
+			configErr.add(field+"."+count.name, fmt.Errorf("%d is negative", count.value))
+		}
+	}
+
+	durations := []struct{ name, value string }{
+		{"MaxBatchAge", options.MaxBatchAge},
+		{"Timeout", options.Timeout},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		if parsed, err := time.ParseDuration(duration.value); err != nil {
+			configErr.add(field+"."+duration.name, err)
+		} else if parsed <= 0 {
+			configErr.add(field+"."+duration.name, fmt.Errorf("%s is not positive", duration.value))
+		}
+	}
+
+	for name, value := range options.Headers {
+		if name == "" {
+			configErr.add(field+".Headers", errors.New("empty header name"))
+		} else if err := validateFieldValue(value); err != nil {
+			configErr.add(fmt.Sprintf("%s.Headers[%s]", field, name), errors.New("invalid header value"))
+		}
+	}
+}
+
+func (options HTTPOptions) copy() HTTPOptions {
+	if options.Headers != nil {
+		headers := make(HTTPHeaders, len(options.Headers))
+		for name, value := range options.Headers {
+			headers[name] = value
+		}
+		options.Headers = headers
+	}
+	return options
+}
+
+// HTTPHeaders are added to the requests of an HTTP sink, e.g. Authorization.
+// Their values are masked when printed, as they usually are credentials.
+type HTTPHeaders map[string]string
+
+func (headers HTTPHeaders) String() string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name+":***")
+	}
+	sort.Strings(names)
+	return "map[" + strings.Join(names, " ") + "]"
+}
+
+// validateHTTPURL checks that rawURL is an absolute http or https URL.
+func validateHTTPURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", rawURL)
+	}
+	return nil
+}
+
+// errNotRetryable wraps the errors of the batches that must not be retried.
+var errNotRetryable = errors.New("not retryable")
+
+// httpWriter POSTs the entries written to it in batches from a background
+// goroutine. Each Write is one JSON entry; entries wait in a spool until sent.
+type httpWriter struct {
+	url         string
+	client      *http.Client
+	body        HTTPBodyFormat
+	gzip        bool
+	headers     HTTPHeaders
+	batchSize   int
+	batchBytes  int64
+	maxBatchAge time.Duration
+	maxRetries  int
+	onFailure   FailurePolicy
+	backoff     *backoff
+
+	lock    sync.Mutex
+	changed *sync.Cond
+	spool   spool
+	// spooled are the times the spooled entries were written, oldest first.
+	// The entries found in a spool file count from when it was opened.
+	spooled []spooledRun
+	now     func() time.Time
+	// flushing counts the Flush calls waiting, which send partial batches.
+	flushing int
+	// failing is set while the endpoint fails.
+	failing bool
+	closed  bool
+	dropped uint64
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func newHTTPWriter(sink SinkConfig) *httpWriter {
+	options := sink.HTTP
+	tlsConfig, _ := sink.TLS.tlsConfig()
+	transport := http.DefaultTransport
+	if tlsConfig != nil {
+		cloned := http.DefaultTransport.(*http.Transport).Clone()
+		cloned.TLSClientConfig = tlsConfig
+		transport = cloned
+	}
+
+	retVal := &httpWriter{
+		url:         sink.URL,
+		client:      &http.Client{Transport: transport, Timeout: defaultHTTPTimeout},
+		body:        options.Body,
+		gzip:        options.Gzip,
+		headers:     options.Headers,
+		batchSize:   options.BatchSize,
+		batchBytes:  int64(options.BatchSizeKB) * 1024,
+		maxBatchAge: defaultHTTPMaxBatchAge,
+		maxRetries:  options.MaxRetries,
+		onFailure:   options.OnFailure,
+		backoff:     sink.Reconnect.backoff(),
+		spool:       sink.Spool.open(),
+		now:         time.Now,
+		wake:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	retVal.changed = sync.NewCond(&retVal.lock)
+	if count := retVal.spool.len(); count > 0 {
+		retVal.spooled = []spooledRun{{at: retVal.now(), count: count}}
+	}
+	if retVal.body == "" {
+		retVal.body = BodyNdjson
+	}
+	if retVal.batchSize == 0 {
+		retVal.batchSize = defaultHTTPBatchSize
+	}
+	if retVal.batchBytes == 0 {
+		retVal.batchBytes = defaultHTTPBatchSizeKB * 1024
+	}
+	if options.MaxBatchAge != "" {
+		retVal.maxBatchAge, _ = time.ParseDuration(options.MaxBatchAge)
+	}
+	if options.MaxRetries == 0 {
+		retVal.maxRetries = defaultHTTPMaxRetries
+	}
+	if retVal.onFailure == "" {
+		retVal.onFailure = FailureDrop
+	}
+	if options.Timeout != "" {
+		retVal.client.Timeout, _ = time.ParseDuration(options.Timeout)
+	}
+
+	go retVal.run()
+
+	return retVal
+}
+
+// Write spools a copy of the entry. Entries written while the spool is full are
+// dropped, and reported to errorOutput once the spool is drained.
+func (w *httpWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, ErrSinkClosed
+	}
+	spooled, err := w.spool.push(bytes.TrimSuffix(append([]byte(nil), p...), []byte("\n")))
+	if err != nil {
+		return 0, err
+	}
+	if spooled {
+		w.spooled = append(w.spooled, spooledRun{at: w.now(), count: 1})
+	} else {
+		w.dropped++
+	}
+	w.changed.Broadcast()
+	return len(p), nil
+}
+
+// Flush sends the spooled entries and waits for them to be sent, unless the
+// endpoint fails.
+func (w *httpWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.flushing++
+	w.changed.Broadcast()
+	for w.spool.len() > 0 && !w.failing && !w.closed {
+		w.changed.Wait()
+	}
+	w.flushing--
+	return nil
+}
+
+// Close sends the spooled entries unless the endpoint fails, and stops the
+// writer. Entries left in a spool file are sent by the next writer opening it.
+func (w *httpWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.wake)
+	w.changed.Broadcast()
+	w.lock.Unlock()
+
+	<-w.done
+	return w.spool.close()
+}
+
+func (w *httpWriter) run() {
+	defer close(w.done)
+
+	for {
+		batch, closing, ok := w.nextBatch()
+		if !ok {
+			return
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		err := w.post(batch)
+		for attempt := 1; err != nil && !errors.Is(err, errNotRetryable) && attempt <= w.maxRetries && !closing; attempt++ {
+			closing = w.sleep(w.backoff.next())
+			if !closing {
+				err = w.post(batch)
+			}
+		}
+		w.sent(len(batch), err, closing)
+		if err != nil && w.onFailure == FailureSpool && !errors.Is(err, errNotRetryable) && !closing {
+			w.sleep(w.backoff.next())
+		}
+	}
+}
+
+// nextBatch waits for a batch to be due and returns it. It returns false once
+// the writer is closed and has nothing more to send.
+func (w *httpWriter) nextBatch() ([][]byte, bool, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		if w.spool.len() == 0 {
+			if w.closed {
+				return nil, true, false
+			}
+			w.changed.Wait()
+			continue
+		}
+		now := w.now()
+		due := w.oldestSpooled().Add(w.maxBatchAge)
+		if w.closed || w.flushing > 0 || w.spool.len() >= w.batchSize || w.spool.size() >= w.batchBytes || !now.Before(due) {
+			break
+		}
+		if timer == nil {
+			timer = time.AfterFunc(due.Sub(now), func() {
+				w.lock.Lock()
+				w.changed.Broadcast()
+				w.lock.Unlock()
+			})
+		}
+		w.changed.Wait()
+	}
+	if w.closed && w.failing {
+		return nil, true, false
+	}
+
+	batch, err := w.spool.peek(w.batchSize)
+	for err == nil && len(batch) > 1 && batchBytes(batch) > w.batchBytes {
+		batch = batch[:len(batch)/2]
+	}
+	if err != nil {
+		fmt.Fprintf(errorOutput, "Failed to read log entries from the spool, dropping them: %v\n", err)
+		w.spool.pop(w.spool.len())
+		w.spooled = nil
+		return nil, w.closed, true
+	}
+	return batch, w.closed, true
+}
+
+func batchBytes(batch [][]byte) int64 {
+	var retVal int64
+	for _, message := range batch {
+		retVal += int64(len(message))
+	}
+	return retVal
+}
+
+// post sends the batch, and returns an error wrapping errNotRetryable when
+// sending it again would fail the same.
+func (w *httpWriter) post(batch [][]byte) error {
+	body := new(bytes.Buffer)
+	var writer io.Writer = body
+	var zipper *gzip.Writer
+	if w.gzip {
+		zipper = gzip.NewWriter(body)
+		writer = zipper
+	}
+	if w.body == BodyJsonArray {
+		writer.Write([]byte("["))
+		writer.Write(bytes.Join(batch, []byte(",")))
+		writer.Write([]byte("]"))
+	} else {
+		for _, message := range batch {
+			writer.Write(message)
+			writer.Write([]byte("\n"))
+		}
+	}
+	if zipper != nil {
+		if err := zipper.Close(); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodPost, w.url, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNotRetryable, err)
+	}
+	request.Header.Set("Content-Type", httpContentTypeNdjson)
+	if w.body == BodyJsonArray {
+		request.Header.Set("Content-Type", httpContentTypeJson)
+	}
+	if zipper != nil {
+		request.Header.Set("Content-Encoding", httpContentEncodingGzip)
+	}
+	for name, value := range w.headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode < 300:
+		return nil
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%s responded %s", w.url, response.Status)
+	}
+	return fmt.Errorf("%w: %s responded %s", errNotRetryable, w.url, response.Status)
+}
+
+// sent pops the batch unless it failed and must stay spooled, and reports
+// the failures and the dropped entries to errorOutput.
+func (w *httpWriter) sent(size int, err error, closing bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	keep := err != nil && !errors.Is(err, errNotRetryable) && (w.onFailure == FailureSpool || closing)
+	switch {
+	case err == nil:
+		w.backoff.reset()
+		w.failing = false
+	case keep:
+		if !w.failing {
+			fmt.Fprintf(errorOutput, "Failed to send log entries to %s, spooling them: %v\n", w.url, err)
+		}
+		w.failing = true
+	default:
+		fmt.Fprintf(errorOutput, "Failed to send %d log entries to %s, dropping them: %v\n", size, w.url, err)
+		w.backoff.reset()
+	}
+	if !keep {
+		if popErr := w.spool.pop(size); popErr != nil {
+			fmt.Fprintf(errorOutput, "Failed to remove sent log entries from the spool: %v\n", popErr)
+		}
+		w.popSpooled(size)
+	}
+	if w.dropped > 0 && w.spool.len() == 0 {
+		fmt.Fprintf(errorOutput, "%d log entries for %s dropped while the spool was full\n", w.dropped, w.url)
+		w.dropped = 0
+	}
+	w.changed.Broadcast()
+}
+
+// spooledRun counts the entries spooled at the same time.
+type spooledRun struct {
+	at    time.Time
+	count int
+}
+
+// oldestSpooled returns when the oldest spooled entry was written.
+func (w *httpWriter) oldestSpooled() time.Time {
+	if len(w.spooled) == 0 {
+		return w.now()
+	}
+	return w.spooled[0].at
+}
+
+// popSpooled forgets the times of the n oldest spooled entries.
+func (w *httpWriter) popSpooled(n int) {
+	for n > 0 && len(w.spooled) > 0 {
+		if w.spooled[0].count > n {
+			w.spooled[0].count -= n
+			return
+		}
+		n -= w.spooled[0].count
+		w.spooled = w.spooled[1:]
+	}
+}
+
+// sleep waits for delay, or until the writer is closed, and reports whether it
+// is.
+func (w *httpWriter) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return false
+	case <-w.wake:
+		return true
+	}
+}
@@ -1,9 +1,16 @@
 package logging
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
-	"io"
 )
 
 type LogFieldNames string
@@ -16,88 +23,433 @@ const (
 	HostnameField                      = "HOSTNAME"
 )
 
+// FieldNameErrorChain and FieldNameErrorStack hold the messages of the errors
+// wrapped by the error of an entry and its stack trace, see
+// JsonLogHook.SetErrorDetails.
+const (
+	FieldNameErrorChain = "error_chain"
+	FieldNameErrorStack = "error_stack"
+)
+
+// FieldNameData holds the fields of an entry in the JSON output, unless the
+// hook flattens them, see JsonLogHook.SetFlattenFields.
+const FieldNameData = "data"
+
+// clashPrefix is prepended to a flattened field named like a key the hook
+// writes itself, as logrus does for its own keys.
+const clashPrefix = "fields."
+
+const (
+	defaultMaxSizeMB  = 1000
+	defaultMaxBackups = 1
+	defaultMaxAgeDays = 30
+)
+
+// ErrSinkClosed is returned when firing an entry on a closed sink.
+var ErrSinkClosed = errors.New("logging: sink is closed")
+
 type JsonLogHook struct {
-	levels       []logrus.Level
+	lock         sync.Mutex
 	fileLogEntry *logrus.Entry
+	writer       io.Writer
+	closer       io.Closer
+	closed       bool
+	// flatten is set to 1 when the fields are written at the top level.
+	flatten int32
+	// errorDetails is set to 1 when the chain and the stack trace of errors
+	// are written.
+	errorDetails int32
 }
 
+// NewJsonLogFileHook creates a hook writing to fileName, rotated at 1000 MB with
+// 1 backup kept for 30 days.
+//
+// Deprecated: use NewRotatingJsonLogFileHook.
 func NewJsonLogFileHook(fileName string, fields LoggerFields, levelToSet logrus.Level) (retVal *JsonLogHook) {
-	fileLG := &lumberjack.Logger{
+	return newLumberjackLogHook(levelToSet, fields, &lumberjack.Logger{
 		Filename:   fileName,
 		MaxSize:    1000,
 		MaxBackups: 1,
 		MaxAge:     30,
 		Compress:   true,
-	}
-
-	return NewJsonLogHook(levelToSet, fields, fileLG)
+	})
 }
 
+// NewJsonLogFileHookWithLogLimits creates a hook writing to fileName, rotated at
+// maxSizeMB with maxBackups backups kept for 7 days. Zero limits keep the
+// defaults of lumberjack: 100 MB and every backup.
+//
+// Deprecated: use NewRotatingJsonLogFileHook.
 func NewJsonLogFileHookWithLogLimits(fileName string, fields LoggerFields, levelToSet logrus.Level, maxSizeMB int, maxBackups int) (retVal *JsonLogHook) {
-	fileLG := &lumberjack.Logger{
+	return newLumberjackLogHook(levelToSet, fields, &lumberjack.Logger{
 		Filename:   fileName,
 		MaxSize:    maxSizeMB,
 		MaxBackups: maxBackups,
 		MaxAge:     7,
 		Compress:   true,
-	}
+	})
+}
 
-	return NewJsonLogHook(levelToSet, fields, fileLG)
+// newLumberjackLogHook creates a hook owning file, which is only rotated by size
+// as the deprecated constructors always have, unlike a RotationPolicy.
+func newLumberjackLogHook(levelToSet logrus.Level, fields LoggerFields, file *lumberjack.Logger) *JsonLogHook {
+	retVal := NewJsonLogHook(levelToSet, fields, file)
+	retVal.closer = file
+	return retVal
+}
+
+// NewRotatingJsonLogFileHook creates a hook writing to fileName, rotated
+// according to policy. The hook owns the file and closes it on Close.
+func NewRotatingJsonLogFileHook(fileName string, fields LoggerFields, levelToSet logrus.Level, policy RotationPolicy) (retVal *JsonLogHook) {
+	file := newRotatingFile(fileName, policy)
+
+	retVal = NewJsonLogHook(levelToSet, fields, file)
+	retVal.closer = file
+	return retVal
 }
 
 func NewJsonLogHook(levelToSet logrus.Level, fields LoggerFields, writer io.Writer) (retVal *JsonLogHook) {
 	logrusLogger := logrus.New()
 	logrusLogger.Level = levelToSet
-	logrusLogger.Out = writer
+	logrusLogger.Out = io.Discard
 	logrusLogger.Formatter = NewLogJsonFormatter()
+	// The caller is written whenever the fired entry has one, i.e. when the
+	// logger that created it reports callers.
+	logrusLogger.ReportCaller = true
 
 	newFileLogEntry := newLogEntry(logrusLogger, fields)
 
-	levels := make([]logrus.Level, 0)
-	for _, nextLevel := range logrus.AllLevels {
-		levels = append(levels, nextLevel)
-		if int32(nextLevel) >= int32(levelToSet) {
-			break
-		}
+	retVal = &JsonLogHook{
+		fileLogEntry: newFileLogEntry,
+		writer:       writer,
 	}
+	return retVal
+}
+
+// NewFormattedLogHook creates a hook writing the entries with formatter, e.g. a
+// logrus.TextFormatter. Unlike the JSON hooks it adds no LoggerFields and
+// writes the fields of the entries as they are.
+func NewFormattedLogHook(levelToSet logrus.Level, formatter logrus.Formatter, writer io.Writer) (retVal *JsonLogHook) {
+	logrusLogger := logrus.New()
+	logrusLogger.Level = levelToSet
+	logrusLogger.Out = io.Discard
+	logrusLogger.Formatter = formatter
+	logrusLogger.ReportCaller = true
 
 	retVal = &JsonLogHook{
-		levels:       levels,
-		fileLogEntry: newFileLogEntry,
+		fileLogEntry: logrus.NewEntry(logrusLogger),
+		writer:       writer,
+		flatten:      1,
 	}
 	return retVal
 }
 
-// Fire is required to implement Logrus hook
+// SetLevel changes the minimum level written by the hook. It is safe to call
+// while entries are being fired.
+func (hook *JsonLogHook) SetLevel(level logrus.Level) {
+	hook.fileLogEntry.Logger.SetLevel(level)
+}
+
+// Level returns the minimum level written by the hook.
+func (hook *JsonLogHook) Level() logrus.Level {
+	return hook.fileLogEntry.Logger.GetLevel()
+}
+
+// SetFlattenFields chooses where the fields of an entry are written: under
+// FieldNameData (the default) or at the top level. A flattened field named like
+// a key the hook writes itself, e.g. "artifact_id" or "message", is prefixed
+// with "fields." until its name is free, the clashing fields being renamed in
+// lexical order.
+func (hook *JsonLogHook) SetFlattenFields(flatten bool) {
+	var value int32
+	if flatten {
+		value = 1
+	}
+	atomic.StoreInt32(&hook.flatten, value)
+}
+
+// SetErrorDetails writes, next to the logrus.ErrorKey field of the entries, the
+// messages of the errors it wraps under FieldNameErrorChain and its stack trace,
+// when it has one, e.g. a github.com/pkg/errors error, under
+// FieldNameErrorStack. The error a segment ended with gets them too.
+func (hook *JsonLogHook) SetErrorDetails(errorDetails bool) {
+	var value int32
+	if errorDetails {
+		value = 1
+	}
+	atomic.StoreInt32(&hook.errorDetails, value)
+}
+
+// Fire is required to implement Logrus hook. It writes the serialized entry at
+// its original level; fatal and panic entries are written like any other, as
+// exiting or panicking is left to the logger that logged them. Serialization and
+// write errors are returned.
 func (hook *JsonLogHook) Fire(entry *logrus.Entry) error {
-	type printMethod func(args ...interface{})
-	var funcToCallForPrint printMethod
-
-	entryTolog := hook.fileLogEntry.WithField("data", entry.Data)
-
-	switch entry.Level {
-	case logrus.DebugLevel:
-		funcToCallForPrint = entryTolog.Debug
-	case logrus.InfoLevel:
-		funcToCallForPrint = entryTolog.Info
-	case logrus.WarnLevel:
-		funcToCallForPrint = entryTolog.Warn
-	case logrus.ErrorLevel:
-		funcToCallForPrint = entryTolog.Error
-	case logrus.FatalLevel:
-		funcToCallForPrint = entryTolog.Fatal
-	case logrus.PanicLevel:
-		funcToCallForPrint = entryTolog.Panic
-	case logrus.TraceLevel:
-		funcToCallForPrint = entryTolog.Trace
-	}
-	funcToCallForPrint(entry.Message)
-	return nil
+	if !hook.fileLogEntry.Logger.IsLevelEnabled(entry.Level) {
+		return nil
+	}
+
+	serialized, err := hook.serialize(entry)
+	if err != nil {
+		return err
+	}
+
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	if hook.closed {
+		return ErrSinkClosed
+	}
+
+	_, err = hook.writer.Write(serialized)
+	return err
+}
+
+// serialize formats the entry as it was logged: its time, level, message,
+// caller and context are kept, and its fields are added to the hook's own.
+func (hook *JsonLogHook) serialize(entry *logrus.Entry) ([]byte, error) {
+	flatten := atomic.LoadInt32(&hook.flatten) == 1
+	if atomic.LoadInt32(&hook.errorDetails) == 1 {
+		entry = withErrorDetails(entry)
+	}
+	entryToLog := layoutEntry(entry, hook.fileLogEntry.Logger, hook.fileLogEntry.Data, flatten)
+	return hook.fileLogEntry.Logger.Formatter.Format(entryToLog)
+}
+
+// layoutEntry returns a copy of entry for logger, with fields followed by the
+// fields of entry, nested under FieldNameData or flattened.
+func layoutEntry(entry *logrus.Entry, logger *logrus.Logger, fields logrus.Fields, flatten bool) *logrus.Entry {
+	retVal := &logrus.Entry{
+		Logger:  logger,
+		Data:    make(logrus.Fields, len(fields)+len(entry.Data)+1),
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Caller:  entry.Caller,
+		Message: entry.Message,
+		Context: entry.Context,
+	}
+	if retVal.Time.IsZero() {
+		retVal.Time = time.Now()
+	}
+	for key, value := range fields {
+		retVal.Data[key] = value
+	}
+
+	if !flatten {
+		data := make(logrus.Fields, len(entry.Data))
+		for key, value := range entry.Data {
+			data[key] = jsonValue(value)
+		}
+		retVal.Data[FieldNameData] = data
+	} else {
+		flattenFields(retVal.Data, entry.Data)
+	}
+	return retVal
+}
+
+// withErrorDetails returns entry with the chain and the stack trace of its
+// error added to its fields, or entry itself when there are none.
+func withErrorDetails(entry *logrus.Entry) *logrus.Entry {
+	err, ok := entry.Data[logrus.ErrorKey].(error)
+	if !ok || err == nil {
+		err = segmentError(entry.Context)
+	}
+	if err == nil {
+		return entry
+	}
+
+	details := make(logrus.Fields, 2)
+	chain, stack := errorDetails(err)
+	if len(chain) > 1 {
+		details[FieldNameErrorChain] = chain
+	}
+	if stack != "" {
+		details[FieldNameErrorStack] = stack
+	}
+	if len(details) == 0 {
+		return entry
+	}
+
+	retVal := *entry
+	retVal.Data = make(logrus.Fields, len(entry.Data)+len(details))
+	for key, value := range entry.Data {
+		retVal.Data[key] = value
+	}
+	for key, value := range details {
+		if _, found := retVal.Data[key]; !found {
+			retVal.Data[key] = value
+		}
+	}
+	return &retVal
+}
+
+// errorDetails returns the chain of err and its stack trace, if any. Those of a
+// redacted error were redacted with its message.
+func errorDetails(err error) ([]string, string) {
+	if redacted, ok := err.(*redactedError); ok {
+		return redacted.chain, redacted.stack
+	}
+	stack := ""
+	if formatter, ok := err.(fmt.Formatter); ok {
+		if formatted := fmt.Sprintf("%+v", formatter); formatted != err.Error() {
+			stack = formatted
+		}
+	}
+	return errorChain(err), stack
+}
+
+// errorChain returns the messages of err and of the errors it wraps, depth
+// first.
+func errorChain(err error) []string {
+	retVal := []string{err.Error()}
+	switch wrapper := err.(type) {
+	case interface{ Unwrap() error }:
+		if wrapped := wrapper.Unwrap(); wrapped != nil {
+			retVal = append(retVal, errorChain(wrapped)...)
+		}
+	case interface{ Unwrap() []error }:
+		for _, wrapped := range wrapper.Unwrap() {
+			if wrapped != nil {
+				retVal = append(retVal, errorChain(wrapped)...)
+			}
+		}
+	}
+	return retVal
+}
+
+// reservedKeys are the keys written by the JSON formatter itself.
+var reservedKeys = []string{"timestamp", "message", logrus.FieldKeyLevel, logrus.FieldKeyFunc, logrus.FieldKeyFile, logrus.FieldKeyLogrusError}
+
+// flattenFields adds fields to data, prefixing the ones clashing with the keys
+// of data or the reserved keys with clashPrefix. The fields are visited in
+// lexical order so the result doesn't depend on map iteration.
+func flattenFields(data logrus.Fields, fields logrus.Fields) {
+	taken := make(map[string]bool, len(data)+len(reservedKeys))
+	for key := range data {
+		taken[key] = true
+	}
+	for _, key := range reservedKeys {
+		taken[key] = true
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var clashing []string
+	for _, key := range keys {
+		if taken[key] {
+			clashing = append(clashing, key)
+			continue
+		}
+		taken[key] = true
+		data[key] = jsonValue(fields[key])
+	}
+	for _, key := range clashing {
+		name := clashPrefix + key
+		for taken[name] {
+			name = clashPrefix + name
+		}
+		taken[name] = true
+		data[name] = jsonValue(fields[key])
+	}
+}
+
+// jsonValue returns the message of errors, which would otherwise be encoded as
+// an empty object.
+func jsonValue(value interface{}) interface{} {
+	if err, ok := value.(error); ok {
+		return err.Error()
+	}
+	return value
 }
 
-// Levels Required for logrus hook implementation
+// Levels Required for logrus hook implementation. The hook registers for every
+// level and filters in Fire, so SetLevel takes effect after registration.
 func (hook *JsonLogHook) Levels() []logrus.Level {
-	return hook.levels
+	return logrus.AllLevels
+}
+
+// Flush flushes the hook's writer when it buffers, i.e. implements Flush() or
+// Sync().
+func (hook *JsonLogHook) Flush() error {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+
+	return hook.flush()
+}
+
+func (hook *JsonLogHook) flush() error {
+	switch writer := hook.writer.(type) {
+	case interface{ Flush() error }:
+		return writer.Flush()
+	case interface{ Sync() error }:
+		return writer.Sync()
+	}
+	return nil
+}
+
+// bufferWrites buffers the writes to the hook's writer until Flush, so that
+// batches of entries are written at once.
+func (hook *JsonLogHook) bufferWrites() {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+
+	hook.writer = &entryWriter{writer: hook.writer}
+}
+
+const entryWriterSize = 4096
+
+// entryWriter buffers the entries written by a JsonLogHook, one per Write, and
+// only hands whole entries to its writer: a rotating file rotates between two
+// writes, which would split a line written in fixed size chunks.
+type entryWriter struct {
+	writer io.Writer
+	buffer []byte
+}
+
+// Write buffers p, after writing the buffered entries if p doesn't fit.
+func (w *entryWriter) Write(p []byte) (int, error) {
+	if len(w.buffer) > 0 && len(w.buffer)+len(p) > entryWriterSize {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	w.buffer = append(w.buffer, p...)
+	return len(p), nil
+}
+
+// Flush writes the buffered entries. They are discarded when the write fails,
+// so a failing writer doesn't hold on to them forever.
+func (w *entryWriter) Flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	_, err := w.writer.Write(w.buffer)
+	w.buffer = w.buffer[:0]
+	return err
+}
+
+// Close flushes the hook and closes the writer it owns, i.e. the rotating log
+// file opened by the file constructors. Writers passed in by the caller are
+// left open. Entries fired after Close fail with ErrSinkClosed.
+func (hook *JsonLogHook) Close() error {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+
+	if hook.closed {
+		return nil
+	}
+	hook.closed = true
+
+	err := hook.flush()
+	if hook.closer != nil {
+		if closeErr := hook.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
 func newLogEntry(logger *logrus.Logger, fields LoggerFields) *logrus.Entry {
@@ -1,10 +1,16 @@
 package logging
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"time"
 
 	"os"
 	"path"
@@ -21,10 +27,25 @@ func Test_NewJsonLogFileHook(t *testing.T) {
 		Hostname:        "pod-1",
 	}
 	obj := NewJsonLogFileHook(logFileName, loggerFields, logrus.TraceLevel)
+	defer obj.Close()
 
 	testNewJsonLogHook(obj, t)
 }
 
+func Test_DeprecatedJsonLogFileHooksShouldOnlyRotateBySize(t *testing.T) {
+	logFileName := path.Join(t.TempDir(), "file.log")
+	assert.NoError(t, os.WriteFile(logFileName, []byte("{}\n"), 0644))
+	yesterday := time.Now().Add(-24 * time.Hour)
+	assert.NoError(t, os.Chtimes(logFileName, yesterday, yesterday))
+
+	hook := NewJsonLogFileHookWithLogLimits(logFileName, LoggerFields{}, logrus.InfoLevel, 0, 0)
+	assert.Equal(t, &lumberjack.Logger{Filename: logFileName, MaxAge: 7, Compress: true}, hook.closer)
+	assert.NoError(t, fireMessage(hook, logrus.InfoLevel, "Test"))
+	assert.NoError(t, hook.Close())
+
+	assert.Len(t, loadLogFile(logFileName), 2)
+}
+
 func Test_NewJsonLogHook(t *testing.T) {
 	loggerFields := LoggerFields{
 		Dc:              "42",
@@ -69,9 +90,218 @@ func testNewJsonLogHook(hook *JsonLogHook, t *testing.T) {
 	expect := assert.New(t)
 
 	expect.NotNil(hook)
-	expect.Equal(hook.levels, logrus.AllLevels)
+	expect.Equal(hook.Levels(), logrus.AllLevels)
 }
 
 func randomStr() string {
 	return "somestring"
 }
+
+func Test_JsonLogHookSetLevelShouldApplyAfterConstruction(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.InfoLevel, LoggerFields{}, buffer)
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.DebugLevel
+
+	hook.Fire(entry)
+	assert.Empty(t, buffer.String())
+
+	hook.SetLevel(logrus.DebugLevel)
+	hook.Fire(entry)
+	assert.NotEmpty(t, buffer.String())
+	assert.Equal(t, logrus.DebugLevel, hook.Level())
+}
+
+func Test_JsonLogHookFlushShouldFlushBufferedWriters(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.InfoLevel, LoggerFields{}, bufio.NewWriter(buffer))
+
+	fireInfo(hook)
+	assert.Empty(t, buffer.String())
+
+	assert.NoError(t, hook.Flush())
+	assert.NotEmpty(t, buffer.String())
+}
+
+func Test_JsonLogHookCloseShouldReleaseTheLogFile(t *testing.T) {
+	logFileName := path.Join(t.TempDir(), "file.log")
+	hook := NewJsonLogFileHook(logFileName, LoggerFields{}, logrus.InfoLevel)
+	fireInfo(hook)
+
+	assert.NoError(t, hook.Close())
+	assert.NoError(t, os.Remove(logFileName))
+	assert.Equal(t, ErrSinkClosed, fireInfo(hook))
+	assert.NoError(t, hook.Close())
+}
+
+func Test_JsonLogFireShouldNotExitOrPanicOnFatalAndPanicEntries(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, buffer)
+
+	for _, level := range []logrus.Level{logrus.FatalLevel, logrus.PanicLevel} {
+		buffer.Reset()
+		assert.NotPanics(t, func() {
+			assert.NoError(t, fireMessage(hook, level, "Test"))
+		})
+
+		jsonMap := make(map[string]interface{})
+		assert.NoError(t, json.Unmarshal(buffer.Bytes(), &jsonMap))
+		assert.Equal(t, level.String(), jsonMap["level"])
+	}
+}
+
+func Test_JsonLogFireShouldReturnWriteErrors(t *testing.T) {
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, failingWriter{})
+
+	assert.Equal(t, errWriteFailed, fireMessage(hook, logrus.InfoLevel, "Test"))
+}
+
+func Test_LoggerShouldFireOtherSinksWhenOneFails(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	failing := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, failingWriter{})
+	working := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, buffer)
+	d := &dispatcher{hooks: []levelSink{failing, working}}
+
+	assert.Equal(t, errWriteFailed, fireMessage(d, logrus.InfoLevel, "Test"))
+	assert.NotEmpty(t, buffer.String())
+}
+
+var errWriteFailed = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func Test_JsonLogFireShouldKeepEntryTimeAndCaller(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, buffer)
+
+	logger := logrus.New()
+	logger.Out = io.Discard
+	logger.ReportCaller = true
+	logger.AddHook(hook)
+	before := time.Now()
+	logger.Info("Test")
+
+	jsonMap := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &jsonMap))
+	timestamp, err := time.Parse(TimestampFormat, jsonMap["timestamp"].(string))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, before, timestamp, time.Second)
+	assert.Contains(t, jsonMap["file"], "json_log_hook_test.go:")
+	assert.Contains(t, jsonMap["func"], "Test_JsonLogFireShouldKeepEntryTimeAndCaller")
+}
+
+func Test_JsonLogFireShouldWriteOriginalTimestamp(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, buffer)
+
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+	entry.Time = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, hook.Fire(entry))
+
+	jsonMap := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &jsonMap))
+	assert.Equal(t, "2020-01-02T03:04:05Z", jsonMap["timestamp"])
+	assert.Nil(t, jsonMap["file"])
+}
+
+func Test_JsonLogFireShouldNestFieldsUnderData(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{ArtifactID: "artifact"}, buffer)
+
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		"artifact_id": "user",
+		"error":       errors.New("failed"),
+	})
+	entry.Level = logrus.InfoLevel
+	assert.NoError(t, hook.Fire(entry))
+
+	jsonMap := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &jsonMap))
+	assert.Equal(t, "artifact", jsonMap["artifact_id"])
+	assert.Equal(t, map[string]interface{}{"artifact_id": "user", "error": "failed"}, jsonMap["data"])
+}
+
+func Test_JsonLogFireShouldFlattenFieldsAndPrefixClashes(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{ArtifactID: "artifact", Hostname: "pod-1"}, buffer)
+	hook.SetFlattenFields(true)
+
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		"obj":                "db",
+		"HOSTNAME":           "user host",
+		"artifact_id":        "user artifact",
+		"fields.artifact_id": "user prefixed",
+		"message":            "user message",
+	})
+	entry.Level = logrus.InfoLevel
+	entry.Message = "Test"
+	assert.NoError(t, hook.Fire(entry))
+
+	jsonMap := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &jsonMap))
+	assert.Nil(t, jsonMap["data"])
+	assert.Equal(t, "db", jsonMap["obj"])
+	assert.Equal(t, "Test", jsonMap["message"])
+	assert.Equal(t, "user message", jsonMap["fields.message"])
+	assert.Equal(t, "pod-1", jsonMap["HOSTNAME"])
+	assert.Equal(t, "user host", jsonMap["fields.HOSTNAME"])
+	assert.Equal(t, "artifact", jsonMap["artifact_id"])
+	assert.Equal(t, "user prefixed", jsonMap["fields.artifact_id"])
+	assert.Equal(t, "user artifact", jsonMap["fields.fields.artifact_id"])
+}
+
+func Test_JsonLogFireShouldWriteErrorDetails(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, buffer)
+	hook.SetErrorDetails(true)
+
+	err := fmt.Errorf("query failed: %w", stackError{"connection refused"})
+	entry := logrus.NewEntry(logrus.New()).WithError(err)
+	entry.Level = logrus.ErrorLevel
+	entry.Message = err.Error()
+	assert.NoError(t, hook.Fire(entry))
+
+	jsonMap := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &jsonMap))
+	data := jsonMap["data"].(map[string]interface{})
+	assert.Equal(t, "query failed: connection refused", data["error"])
+	assert.Equal(t, []interface{}{"query failed: connection refused", "connection refused"}, data["error_chain"])
+	assert.Nil(t, data["error_stack"])
+}
+
+func Test_JsonLogFireShouldWriteErrorStack(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.TraceLevel, LoggerFields{}, buffer)
+	hook.SetErrorDetails(true)
+
+	entry := logrus.NewEntry(logrus.New()).WithError(stackError{"connection refused"})
+	entry.Level = logrus.ErrorLevel
+	assert.NoError(t, hook.Fire(entry))
+
+	jsonMap := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &jsonMap))
+	data := jsonMap["data"].(map[string]interface{})
+	assert.Nil(t, data["error_chain"])
+	assert.Equal(t, "connection refused\nmain.main()\n\tmain.go:1", data["error_stack"])
+}
+
+// stackError formats with a stack trace for %+v, like github.com/pkg/errors.
+type stackError struct {
+	message string
+}
+
+func (e stackError) Error() string {
+	return e.message
+}
+
+func (e stackError) Format(s fmt.State, verb rune) {
+	io.WriteString(s, e.message)
+	if s.Flag('+') {
+		io.WriteString(s, "\nmain.main()\n\tmain.go:1")
+	}
+}
@@ -24,3 +24,26 @@ func NewLogJsonFormatter() *LogJsonFormatter {
 func (f *LogJsonFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	return f.JSONFormatter.Format(entry)
 }
+
+// LogstashJsonFormatter formats entries with the schema of the JSON log file:
+// the LoggerFields at the top level and the fields of the entry under "data",
+// or flattened. It lets a logger write that schema to any output, e.g. stdout.
+type LogstashJsonFormatter struct {
+	json          *LogJsonFormatter
+	fields        logrus.Fields
+	flattenFields bool
+}
+
+// NewLogstashJsonFormatter creates a formatter adding fields to every entry.
+// See JsonLogHook.SetFlattenFields for flattenFields.
+func NewLogstashJsonFormatter(fields LoggerFields, flattenFields bool) *LogstashJsonFormatter {
+	return &LogstashJsonFormatter{
+		json:          NewLogJsonFormatter(),
+		fields:        newLogEntry(nil, fields).Data,
+		flattenFields: flattenFields,
+	}
+}
+
+func (f *LogstashJsonFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return f.json.Format(layoutEntry(entry, entry.Logger, f.fields, f.flattenFields))
+}
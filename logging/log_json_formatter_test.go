@@ -1,9 +1,13 @@
 package logging
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 const expectedTimestampFieldName = "timestamp"
@@ -19,3 +23,46 @@ func Test_LogFieldNames(t *testing.T) {
 	actualMessageFieldName := formatter.FieldMap[logrus.FieldKeyMsg]
 	expect.Equal(expectedMessageFieldName, actualMessageFieldName)
 }
+
+func Test_LogJsonToStdoutShouldWriteTheJsonLogFileSchema(t *testing.T) {
+	fields := LoggerFields{
+		Dc:              "42",
+		ArtifactID:      "com.wixpress.artifact",
+		ArtifactVersion: "1.0.1",
+		Hostname:        "pod-1",
+	}
+	logger, err := New(Config{Level: "info", LogJsonToStdout: true, AdditionalFields: fields})
+	assert.NoError(t, err)
+	defer logger.Close()
+	stdout, file := new(bytes.Buffer), new(bytes.Buffer)
+	logger.setOutput(stdout)
+	logger.logger.AddHook(NewJsonLogHook(logrus.InfoLevel, fields, file))
+
+	logger.GetLog("test").WithField("action", "someaction").Info("Test")
+
+	stdoutMap, fileMap := make(map[string]interface{}), make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &stdoutMap))
+	assert.NoError(t, json.Unmarshal(file.Bytes(), &fileMap))
+	assert.Equal(t, fileMap, stdoutMap)
+	assert.Equal(t, "pod-1", stdoutMap["HOSTNAME"])
+	assert.Equal(t, map[string]interface{}{"obj": "test", "action": "someaction"}, stdoutMap["data"])
+}
+
+func Test_LogJsonToStdoutShouldRestoreTheConsoleWhenDisabled(t *testing.T) {
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+	defer logger.Close()
+	console := new(bytes.Buffer)
+	logger.setOutput(console)
+
+	config := logger.currentConfig()
+	config.LogJsonToStdout = true
+	assert.NoError(t, logger.Reload(config))
+	assert.Equal(t, skipEmptyWrites{os.Stdout}, logger.logger.Out)
+
+	config.LogJsonToStdout = false
+	assert.NoError(t, logger.Reload(config))
+	logger.GetLog("test").Info("Test")
+
+	assert.Contains(t, console.String(), `level=info msg=Test obj=test`)
+}
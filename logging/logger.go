@@ -2,7 +2,10 @@ package logging
 
 import (
 	"fmt"
-	"path"
+	"io"
+	"os"
+	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/logrusorgru/aurora"
@@ -10,65 +13,578 @@ import (
 )
 
 type LoggerFields struct {
-	ArtifactID      string
-	ArtifactVersion string
-	Hostname        string
-	Dc              string
+	ArtifactID      string `json:"artifact_id" yaml:"artifact_id" toml:"artifact_id" env:"ARTIFACT_ID"`
+	ArtifactVersion string `json:"artifact_version" yaml:"artifact_version" toml:"artifact_version" env:"ARTIFACT_VERSION"`
+	Hostname        string `json:"hostname" yaml:"hostname" toml:"hostname" env:"HOSTNAME"`
+	Dc              string `json:"dc" yaml:"dc" toml:"dc" env:"DC"`
 }
 
 type Config struct {
-	AppName          string
-	LogsFolder       string
-	LogToJsonFile    bool
-	Level            string
-	Colors           bool
-	AdditionalFields LoggerFields
+	AppName          string       `json:"app_name" yaml:"app_name" toml:"app_name" env:"APP_NAME"`
+	LogsFolder       string       `json:"logs_folder" yaml:"logs_folder" toml:"logs_folder" env:"LOGS_FOLDER"`
+	LogToJsonFile    bool         `json:"log_to_json_file" yaml:"log_to_json_file" toml:"log_to_json_file" env:"LOG_TO_JSON_FILE"`
+	Level            string       `json:"level" yaml:"level" toml:"level" env:"LEVEL"`
+	Colors           bool         `json:"colors" yaml:"colors" toml:"colors" env:"COLORS"`
+	AdditionalFields LoggerFields `json:"additional_fields" yaml:"additional_fields" toml:"additional_fields"`
+	// MaxSizeMB and MaxBackups limit the JSON log file. Zero keeps the
+	// defaults of RotationPolicy. Rotation.MaxSizeMB and Rotation.MaxBackups
+	// take precedence.
+	MaxSizeMB  int `json:"max_size_mb" yaml:"max_size_mb" toml:"max_size_mb" env:"MAX_SIZE_MB"`
+	MaxBackups int `json:"max_backups" yaml:"max_backups" toml:"max_backups" env:"MAX_BACKUPS"`
+	// Rotation rotates the log files by time and on start, see RotationPolicy.
+	Rotation RotationPolicy `json:"rotation" yaml:"rotation" toml:"rotation"`
+	// ObjLevels overrides Level for the entries whose obj field matches a key,
+	// e.g. {"db": "warn", "http.*": "trace"}. See Logger.SetObjLevel.
+	ObjLevels map[string]string `json:"obj_levels" yaml:"obj_levels" toml:"obj_levels" env:"OBJ_LEVELS"`
+	// Async makes the JSON log file written from a background goroutine when
+	// Async.BufferSize is set, see AsyncJsonLogHook.
+	Async AsyncOptions `json:"async" yaml:"async" toml:"async"`
+	// LogErrorsToJsonFile also writes the warn and more severe entries to
+	// <app>_errors_json.log in LogsFolder, with the chain and the stack trace of
+	// their error, see JsonLogHook.SetErrorDetails.
+	LogErrorsToJsonFile bool `json:"log_errors_to_json_file" yaml:"log_errors_to_json_file" toml:"log_errors_to_json_file" env:"LOG_ERRORS_TO_JSON_FILE"`
+	// ErrorsRotation rotates the errors log file. Its backups are kept longer
+	// than those of the main log file by default: 10 backups for 90 days.
+	ErrorsRotation RotationPolicy `json:"errors_rotation" yaml:"errors_rotation" toml:"errors_rotation" env:"ERRORS_"`
+	// FlattenFields writes the fields of the entries at the top level of the
+	// JSON log file instead of under "data", see JsonLogHook.SetFlattenFields.
+	FlattenFields bool `json:"flatten_fields" yaml:"flatten_fields" toml:"flatten_fields" env:"FLATTEN_FIELDS"`
+	// ReportCaller adds the file, line and function logging each entry.
+	ReportCaller bool `json:"report_caller" yaml:"report_caller" toml:"report_caller" env:"REPORT_CALLER"`
+	// LogJsonToStdout makes the console output the JSON log file schema
+	// written to stdout, with the AdditionalFields, for collectors reading the
+	// output of containers. See LogstashJsonFormatter.
+	LogJsonToStdout bool `json:"log_json_to_stdout" yaml:"log_json_to_stdout" toml:"log_json_to_stdout" env:"LOG_JSON_TO_STDOUT"`
+	// Redaction removes sensitive data from the entries of every output, see
+	// RedactionConfig.
+	Redaction RedactionConfig `json:"redaction" yaml:"redaction" toml:"redaction" env:"REDACT_"`
+	// Sampling limits the repeated entries of hot loops, see SamplingConfig.
+	Sampling SamplingConfig `json:"sampling" yaml:"sampling" toml:"sampling" env:"SAMPLING_"`
+	// Dedup collapses runs of identical entries, see DedupConfig.
+	Dedup DedupConfig `json:"dedup" yaml:"dedup" toml:"dedup" env:"DEDUP_"`
+	// TailBuffer holds the debug entries of the traces and logs them only
+	// when the trace fails, see TailBufferConfig.
+	TailBuffer TailBufferConfig `json:"tail_buffer" yaml:"tail_buffer" toml:"tail_buffer" env:"TAIL_BUFFER_"`
+	// TraceIds is the format of the ids of the traces started by
+	// Logger.NewTrace and of their segments, TraceIdsUUID by default.
+	TraceIds TraceIdFormat `json:"trace_ids" yaml:"trace_ids" toml:"trace_ids" env:"TRACE_IDS"`
+	// Sinks adds outputs with their own destination, format and level. When
+	// set, they replace the default console output; the JSON log file is still
+	// written when LogToJsonFile is set. See SinkConfig.
+	Sinks []SinkConfig `json:"sinks" yaml:"sinks" toml:"sinks"`
 }
 
-var loggerEntry *logrus.Entry
-var colorSupport aurora.Aurora
+// Logger is an independently configured logging instance. It owns its logrus
+// logger, hooks and color support, so several components running in one binary
+// can each log with their own app name, logs folder and level.
+//
+// The underlying logrus logger lives as long as the Logger does: reconfiguring
+// swaps its level and hooks in place, so entries obtained from GetLog before a
+// reconfiguration keep working afterwards.
+type Logger struct {
+	lock         sync.RWMutex
+	logger       *logrus.Logger
+	dispatcher   *dispatcher
+	config       Config
+	colorSupport aurora.Aurora
+	sinks        map[string]runningSink
+	// console is the console output while it is replaced by Config.Sinks or
+	// Config.LogJsonToStdout.
+	console io.Writer
+}
+
+// sinkSpec describes a sink required by a Config. A sink with the same key is
+// kept across reconfigurations and only has its level updated.
+type sinkSpec struct {
+	key   string
+	name  string
+	level logrus.Level
+	// applied is the level the sink logs at once the obj levels are applied,
+	// while level may be more verbose to let the obj levels through.
+	applied logrus.Level
+	build   func() (levelSink, error)
+}
+
+type runningSink struct {
+	name    string
+	hook    levelSink
+	applied logrus.Level
+}
+
+// std is the default instance behind the package-level functions.
+var std = newLogger()
+
+// New creates a Logger configured by config. An invalid config is reported as a
+// *ConfigError.
+func New(config Config) (*Logger, error) {
+	l := newLogger()
+	if err := l.configure(config); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func newLogger() *Logger {
+	l := &Logger{
+		logger:       logrus.New(),
+		dispatcher:   &dispatcher{},
+		colorSupport: aurora.NewAurora(false),
+		sinks:        make(map[string]runningSink),
+	}
+	l.logger.AddHook(l.dispatcher)
+	l.setOutput(l.logger.Out)
+	l.logger.Formatter = &filteringFormatter{
+		Formatter:  l.logger.Formatter,
+		dispatcher: l.dispatcher,
+	}
+
+	return l
+}
+
+// GetCS returns the color support configured for this Logger.
+func (l *Logger) GetCS() (retVal aurora.Aurora) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
 
+	return l.colorSupport
+}
+
+// GetLog returns an entry tagged with the given obj field.
+func (l *Logger) GetLog(obj string) (retVal *logrus.Entry) {
+	retVal = logrus.NewEntry(l.logger).WithField(FieldNameObj, obj)
+	return retVal
+}
+
+// NewTrace starts a new Trace logging through this Logger, with a tail buffer
+// when Config.TailBuffer is set and the ids of Config.TraceIds.
+func (l *Logger) NewTrace(action string) Trace {
+	entry, config := l.traceEntry()
+	if config.TraceIds == TraceIdsW3C {
+		return NewW3CTrace(action, entry)
+	}
+	return NewTrace(action, entry)
+}
+
+// ContinueTrace starts a Trace logging through this Logger that continues the
+// trace of the caller, see ContinueTrace.
+func (l *Logger) ContinueTrace(action string, parent TraceParent, state TraceState) Trace {
+	entry, _ := l.traceEntry()
+	return ContinueTrace(action, parent, state, entry)
+}
+
+// traceEntry returns the entry of a new trace, with its tail buffer, and the
+// config it was created with.
+func (l *Logger) traceEntry() (*logrus.Entry, Config) {
+	l.lock.RLock()
+	config := l.config
+	l.lock.RUnlock()
+
+	entry := logrus.NewEntry(l.logger)
+	if config.TailBuffer.Size > 0 {
+		entry = entry.WithContext(withTailBuffer(nil, newTailBuffer(config.TailBuffer.Size, config.TailBuffer.level())))
+	}
+	return entry, config
+}
+
+// Reload applies config to the running Logger without losing entries: the
+// level of the logger and its sinks is swapped together with the sinks that
+// were added or removed, and an audit entry describing the changes is logged.
+// When config is invalid the current configuration is kept.
+func (l *Logger) Reload(config Config) error {
+	return l.reloadWith(func(current *Config) {
+		*current = config
+	})
+}
+
+// SetObjLevel changes the level of the entries whose obj matches objPattern at
+// runtime, see Config.ObjLevels. The change is logged like a Reload.
+func (l *Logger) SetObjLevel(objPattern string, level string) error {
+	return l.reloadWith(func(config *Config) {
+		config.ObjLevels[objPattern] = level
+	})
+}
+
+// ClearObjLevel removes the level override of objPattern, so the matching
+// entries use the global level again.
+func (l *Logger) ClearObjLevel(objPattern string) error {
+	return l.reloadWith(func(config *Config) {
+		delete(config.ObjLevels, objPattern)
+	})
+}
+
+func (l *Logger) reloadWith(modify func(config *Config)) error {
+	changes, err := l.update(modify)
+	if err != nil {
+		return err
+	}
+
+	l.GetLog("logging").
+		WithField("changes", changes).
+		Info("Logging configuration reloaded")
+	return nil
+}
+
+// Flush reports the entries held back by dedup and sampling and flushes the
+// sinks owned by this Logger.
+func (l *Logger) Flush() (retVal error) {
+	l.dispatcher.flush()
+	for _, sink := range l.runningSinks() {
+		if err := sink.hook.Flush(); err != nil && retVal == nil {
+			retVal = err
+		}
+	}
+	return retVal
+}
+
+// Stats returns the counters of the sinks writing in the background, i.e. the
+// JSON log files with Config.Async, by sink name.
+func (l *Logger) Stats() map[string]AsyncStats {
+	stats := make(map[string]AsyncStats)
+	for _, sink := range l.runningSinks() {
+		if async, ok := sink.hook.(*AsyncJsonLogHook); ok {
+			stats[sink.name] = async.Stats()
+		}
+	}
+	return stats
+}
+
+// Close detaches, flushes and closes the sinks owned by this Logger. Entries
+// logged after Close are still written to the console, and a later Reload opens
+// the sinks again.
+func (l *Logger) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	unregister(l)
+
+	removed := make([]levelSink, 0, len(l.sinks))
+	for _, sink := range l.sinks {
+		removed = append(removed, sink.hook)
+	}
+	l.dispatcher.flush()
+	l.dispatcher.swap(nil, l.dispatcher.stages, func() {})
+	l.sinks = make(map[string]runningSink)
+
+	return closeHooks(removed)
+}
+
+// SetLogConfig reconfigures the default Logger and panics if config is invalid.
+// Use SetLogConfigE to handle configuration errors instead.
 func SetLogConfig(config Config) {
-	configureLogger(config)
+	if err := SetLogConfigE(config); err != nil {
+		panic(err)
+	}
+}
+
+// SetLogConfigE reconfigures the default Logger. When config is invalid the
+// current configuration is kept and a *ConfigError listing every problem is
+// returned.
+func SetLogConfigE(config Config) error {
+	return std.configure(config)
 }
 
 func GetCS() (retVal aurora.Aurora) {
-	return colorSupport
+	return std.GetCS()
 }
 
 func GetLog(obj string) (retVal *logrus.Entry) {
-	retVal = loggerEntry.WithField("obj", obj)
-	return retVal
+	return std.GetLog(obj)
+}
+
+// SetObjLevel changes the obj level of the default Logger, see
+// Logger.SetObjLevel.
+func SetObjLevel(objPattern string, level string) error {
+	return std.SetObjLevel(objPattern, level)
+}
+
+// ClearObjLevel removes an obj level of the default Logger, see
+// Logger.ClearObjLevel.
+func ClearObjLevel(objPattern string) error {
+	return std.ClearObjLevel(objPattern)
+}
+
+// Stats returns the counters of the asynchronous sinks of the default Logger,
+// see Logger.Stats.
+func Stats() map[string]AsyncStats {
+	return std.Stats()
 }
 
 func init() {
-	configureLogger(Config{
-		Level:  "debug",
-		Colors: false,
+	SetLogConfig(DefaultConfig())
+}
+
+func (l *Logger) configure(config Config) error {
+	_, err := l.update(func(current *Config) {
+		*current = config
 	})
+	if err != nil {
+		return err
+	}
+
+	l.GetLog("logging").Info("Logging module configured successfully with", config)
+	return nil
 }
 
-func configureLogger(config Config) {
-	lock := sync.Mutex{}
-	lock.Lock()
-	defer lock.Unlock()
+// update lets modify change a copy of the current config, validates it and
+// swaps it in, returning a description of what changed.
+func (l *Logger) update(modify func(config *Config)) ([]string, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
 
-	levelStr := config.Level
-	logger := logrus.New()
-	logLevel, err := logrus.ParseLevel(levelStr)
-	if err != nil {
-		panic(err)
+	config := l.config.copy()
+	modify(&config)
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	logLevel, _ := logrus.ParseLevel(config.Level)
+	objLevels, _ := newObjLevels(logLevel, config.ObjLevels)
+
+	changes := make([]string, 0)
+	if l.config.Level != config.Level {
+		changes = append(changes, fmt.Sprintf("level %q -> %q", l.config.Level, config.Level))
+	}
+	if l.config.Colors != config.Colors {
+		changes = append(changes, fmt.Sprintf("colors %v -> %v", l.config.Colors, config.Colors))
+	}
+	if l.config.ReportCaller != config.ReportCaller {
+		changes = append(changes, fmt.Sprintf("report caller %v -> %v", l.config.ReportCaller, config.ReportCaller))
+	}
+	if !reflect.DeepEqual(l.config.Redaction, config.Redaction) {
+		changes = append(changes, "redaction updated")
+	}
+	samplingChanged := !reflect.DeepEqual(l.config.Sampling, config.Sampling)
+	if samplingChanged {
+		changes = append(changes, "sampling updated")
+	}
+	dedupChanged := !reflect.DeepEqual(l.config.Dedup, config.Dedup)
+	if dedupChanged {
+		changes = append(changes, "dedup updated")
+	}
+	if l.config.TailBuffer != config.TailBuffer {
+		changes = append(changes, "tail buffer updated")
+	}
+	changes = append(changes, objLevelChanges(l.config.ObjLevels, config.ObjLevels)...)
+
+	// The entries held by the tail buffers are created and reach the sinks,
+	// the obj levels filter them out unless their trace failed.
+	mostVerbose := objLevels.mostVerbose()
+	if tailLevel := config.TailBuffer.level(); tailLevel > mostVerbose {
+		mostVerbose = tailLevel
+	}
+	specs := sinkSpecs(config, mostVerbose)
+	sinks := make(map[string]runningSink, len(specs))
+	hooks := make([]levelSink, 0, len(specs))
+	added := make([]levelSink, 0)
+	for _, spec := range specs {
+		sink, found := l.sinks[spec.key]
+		if !found {
+			hook, err := spec.build()
+			if err != nil {
+				closeHooks(added)
+				return nil, fmt.Errorf("sink %s: %w", spec.name, err)
+			}
+			added = append(added, hook)
+			sink = runningSink{name: spec.name, hook: hook}
+			changes = append(changes, "added sink "+spec.name)
+		} else if sink.applied != spec.applied {
+			changes = append(changes, fmt.Sprintf("sink %s level %q -> %q", spec.name, sink.applied, spec.applied))
+		}
+		sink.applied = spec.applied
+		sinks[spec.key] = sink
+		hooks = append(hooks, sink.hook)
+	}
+
+	removed := make([]levelSink, 0)
+	removedNames := make([]string, 0)
+	for key, sink := range l.sinks {
+		if _, found := sinks[key]; !found {
+			removed = append(removed, sink.hook)
+			removedNames = append(removedNames, "removed sink "+sink.name)
+		}
+	}
+	sort.Strings(removedNames)
+	changes = append(changes, removedNames...)
+
+	previousStages := l.dispatcher.stages
+	stages := stages{
+		objLevels: objLevels,
+		deduper:   previousStages.deduper,
+		sampler:   previousStages.sampler,
+		redactor:  newRedactor(config.Redaction),
+	}
+	if dedupChanged {
+		stages.deduper = newDeduper(config.Dedup, l.logger)
+	}
+	if samplingChanged {
+		stages.sampler = newSampler(config.Sampling, l.logger)
+	}
+	l.dispatcher.swap(hooks, stages, func() {
+		l.logger.SetLevel(mostVerbose)
+		l.logger.SetReportCaller(config.ReportCaller)
+		l.setConsole(config)
+		for i, spec := range specs {
+			hooks[i].SetLevel(spec.level)
+		}
+	})
+	if dedupChanged && previousStages.deduper != nil {
+		previousStages.deduper.flush()
+	}
+	if samplingChanged && previousStages.sampler != nil {
+		previousStages.sampler.flush()
+	}
+	l.config = config
+	l.colorSupport = aurora.NewAurora(config.Colors)
+	l.sinks = sinks
+	register(l)
+
+	if err := closeHooks(removed); err != nil {
+		l.GetLog("logging").Warn("Failed to close removed log sinks: ", err)
+	}
+	return changes, nil
+}
+
+// setConsole discards the console output while Config.Sinks are configured,
+// or replaces it by JSON to stdout with Config.LogJsonToStdout, and restores it
+// once neither is set. It must be called before l.config is updated.
+func (l *Logger) setConsole(config Config) {
+	var out io.Writer
+	switch {
+	case len(config.Sinks) > 0:
+		out = io.Discard
+	case config.LogJsonToStdout:
+		out = os.Stdout
+	}
+	switch {
+	case out != nil && l.console == nil:
+		l.console = l.logger.Out
+		l.setOutput(out)
+	case out != nil:
+		l.setOutput(out)
+	case l.console != nil:
+		l.setOutput(l.console)
+		l.console = nil
 	}
-	logger.SetLevel(logLevel)
 
+	var formatter logrus.Formatter
+	switch {
+	case config.LogJsonToStdout:
+		formatter = NewLogstashJsonFormatter(config.AdditionalFields, config.FlattenFields)
+	case l.config.LogJsonToStdout:
+		formatter = new(logrus.TextFormatter)
+	default:
+		return
+	}
+	l.logger.SetFormatter(&filteringFormatter{
+		Formatter:  formatter,
+		dispatcher: l.dispatcher,
+	})
+}
+
+// setOutput replaces the console output.
+func (l *Logger) setOutput(out io.Writer) {
+	if _, ok := out.(skipEmptyWrites); !ok {
+		out = skipEmptyWrites{out}
+	}
+	l.logger.SetOutput(out)
+}
+
+func objLevelChanges(previous map[string]string, current map[string]string) []string {
+	changes := make([]string, 0)
+	for obj, level := range current {
+		if previous[obj] != level {
+			changes = append(changes, fmt.Sprintf("obj %q level %q -> %q", obj, previous[obj], level))
+		}
+	}
+	for obj, level := range previous {
+		if _, found := current[obj]; !found {
+			changes = append(changes, fmt.Sprintf("obj %q level %q -> %q", obj, level, ""))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func sinkSpecs(config Config, logLevel logrus.Level) []sinkSpec {
+	configLevel, _ := logrus.ParseLevel(config.Level)
+	specs := make([]sinkSpec, 0)
 	if config.LogToJsonFile {
-		shortLogFileName := fmt.Sprintf("%s_logstash_json.log", config.AppName)
-		logFileName := path.Join(config.LogsFolder, shortLogFileName)
-		fileHook := NewJsonLogFileHook(logFileName, config.AdditionalFields, logLevel)
-		logger.Hooks.Add(fileHook)
+		fileName := jsonLogFileName(config)
+		specs = append(specs, sinkSpec{
+			key:     fmt.Sprintf("json_file %s %+v %+v %+v %v", fileName, config.rotationPolicy(), config.AdditionalFields, config.Async, config.FlattenFields),
+			name:    "json_file " + fileName,
+			level:   logLevel,
+			applied: configLevel,
+			build: func() (levelSink, error) {
+				hook := newConfiguredJsonLogFileHook(config, logLevel)
+				hook.SetFlattenFields(config.FlattenFields)
+				return withAsync(hook, config.Async)
+			},
+		})
+	}
+	if config.LogErrorsToJsonFile {
+		fileName := errorsLogFileName(config)
+		specs = append(specs, sinkSpec{
+			key:     fmt.Sprintf("errors_file %s %+v %+v %+v %v", fileName, config.errorsRotationPolicy(), config.AdditionalFields, config.Async, config.FlattenFields),
+			name:    "errors_file " + fileName,
+			level:   logrus.WarnLevel,
+			applied: logrus.WarnLevel,
+			build: func() (levelSink, error) {
+				hook := NewRotatingJsonLogFileHook(fileName, config.AdditionalFields, logrus.WarnLevel, config.errorsRotationPolicy())
+				hook.SetFlattenFields(config.FlattenFields)
+				hook.SetErrorDetails(true)
+				return withAsync(hook, config.Async)
+			},
+		})
 	}
+	for i, sink := range config.Sinks {
+		sink := sink
+		level, applied := logLevel, configLevel
+		if sink.Level != "" {
+			level, _ = logrus.ParseLevel(sink.Level)
+			applied = level
+		}
+		specs = append(specs, sinkSpec{
+			key:     sink.key(i, config),
+			name:    sink.name(),
+			level:   level,
+			applied: applied,
+			build: func() (levelSink, error) {
+				hook := sink.build(config, level)
+				if sink.Destination != DestinationFile {
+					return hook, nil
+				}
+				return withAsync(hook, config.Async)
+			},
+		})
+	}
+	return specs
+}
 
-	colorSupport = aurora.NewAurora(config.Colors)
-	loggerEntry = logrus.NewEntry(logger)
-	GetLog("logging").Info("Logging module configured successfully with", config)
+// withAsync wraps hook in an AsyncJsonLogHook when options has a buffer, and
+// closes hook when options are invalid.
+func withAsync(hook *JsonLogHook, options AsyncOptions) (levelSink, error) {
+	if options.BufferSize == 0 {
+		return hook, nil
+	}
+	asyncHook, err := NewAsyncJsonLogHook(hook, options)
+	if err != nil {
+		hook.Close()
+		return nil, err
+	}
+	return asyncHook, nil
+}
+
+func newConfiguredJsonLogFileHook(config Config, logLevel logrus.Level) *JsonLogHook {
+	return NewRotatingJsonLogFileHook(jsonLogFileName(config), config.AdditionalFields, logLevel, config.rotationPolicy())
+}
+
+func closeHooks(hooks []levelSink) (retVal error) {
+	for _, hook := range hooks {
+		if err := hook.Close(); err != nil && retVal == nil {
+			retVal = err
+		}
+	}
+	return retVal
 }
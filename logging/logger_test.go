@@ -1,12 +1,14 @@
 package logging
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/sirupsen/logrus"
@@ -53,6 +55,7 @@ func Test_LogFileCreation(t *testing.T) {
 	os.Remove(expectedFileName)
 	assert.False(t, checkFileExist(expectedFileName))
 	defer func() {
+		Shutdown(context.Background())
 		os.Remove(expectedFileName)
 	}()
 
@@ -94,6 +97,7 @@ func Test_LogDataConversion(t *testing.T) {
 	assert.False(t, checkFileExist(expectedFileName))
 
 	defer func() {
+		Shutdown(context.Background())
 		os.Remove(expectedFileName)
 	}()
 
@@ -119,3 +123,139 @@ func Test_LogDataConversion(t *testing.T) {
 	dataEntry := entries[1]["data"].(map[string]interface{})
 	assert.Equal(t, dataEntry["action"].(string), "someaction")
 }
+
+func Test_LoggerShouldWriteWarningsAndErrorsToErrorsFile(t *testing.T) {
+	folder := t.TempDir()
+
+	logger, err := New(Config{
+		AppName:             appName,
+		LogsFolder:          folder,
+		LogErrorsToJsonFile: true,
+		Level:               "debug",
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	logger.GetLog("test").Info("info")
+	logger.GetLog("test").Warn("warning")
+	logger.NewTrace("action").StartSegment("segment").EndWithErrorIf(fmt.Errorf("failed: %w", os.ErrNotExist))
+	assert.NoError(t, logger.Flush())
+
+	entries := loadLogFile(path.Join(folder, fmt.Sprintf("%s_errors_json.log", appName)))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "warning", entries[0]["message"])
+	assert.Equal(t, "error", entries[1]["level"])
+	data := entries[1]["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"failed: file does not exist", "file does not exist"}, data["error_chain"])
+	assert.False(t, checkFileExist(path.Join(folder, fmt.Sprintf("%s_logstash_json.log", appName))))
+}
+
+func Test_LoggerShouldFlattenFieldsAndReportCaller(t *testing.T) {
+	folder := t.TempDir()
+
+	logger, err := New(Config{
+		AppName:       appName,
+		LogsFolder:    folder,
+		LogToJsonFile: true,
+		Level:         "debug",
+		FlattenFields: true,
+		ReportCaller:  true,
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	logger.GetLog("test").WithField("action", "someaction").Info("Test")
+	assert.NoError(t, logger.Flush())
+
+	entries := loadLogFile(path.Join(folder, fmt.Sprintf("%s_logstash_json.log", appName)))
+	assert.Len(t, entries, 2)
+	assert.Nil(t, entries[1]["data"])
+	assert.Equal(t, "test", entries[1]["obj"])
+	assert.Equal(t, "someaction", entries[1]["action"])
+	assert.Contains(t, entries[1]["file"], "logger_test.go:")
+}
+
+func Test_NewLoggerInstancesAreIndependent(t *testing.T) {
+	folder := t.TempDir()
+
+	dbLogger, err := New(Config{
+		AppName:       "db",
+		LogsFolder:    folder,
+		LogToJsonFile: true,
+		Level:         "warn",
+	})
+	assert.NoError(t, err)
+	defer dbLogger.Close()
+
+	httpLogger, err := New(Config{
+		AppName:       "http",
+		LogsFolder:    folder,
+		LogToJsonFile: true,
+		Level:         "debug",
+	})
+	assert.NoError(t, err)
+	defer httpLogger.Close()
+
+	dbLogger.GetLog("test").Info("Should be filtered")
+	httpLogger.GetLog("test").Info("Test")
+
+	assert.Equal(t, logrus.WarnLevel, dbLogger.GetLog("test").Logger.Level)
+	assert.Equal(t, logrus.DebugLevel, httpLogger.GetLog("test").Logger.Level)
+	assert.False(t, checkFileExist(path.Join(folder, "db_logstash_json.log")))
+	assert.Len(t, loadLogFile(path.Join(folder, "http_logstash_json.log")), 2)
+}
+
+func Test_NewLoggerWithInvalidLevelShouldReturnError(t *testing.T) {
+	logger, err := New(Config{Level: "loud"})
+
+	assert.Error(t, err)
+	assert.Nil(t, logger)
+}
+
+func Test_SinksWithInvalidAsyncOptionsShouldFailToBuild(t *testing.T) {
+	specs := sinkSpecs(Config{
+		AppName:             appName,
+		LogsFolder:          t.TempDir(),
+		LogToJsonFile:       true,
+		LogErrorsToJsonFile: true,
+		Level:               "info",
+		Async:               AsyncOptions{BufferSize: 10, Overflow: "unknown"},
+	}, logrus.InfoLevel)
+
+	assert.Len(t, specs, 2)
+	for _, spec := range specs {
+		hook, err := spec.build()
+		assert.Error(t, err, spec.name)
+		assert.Nil(t, hook, spec.name)
+	}
+}
+
+func Test_EntriesObtainedBeforeReconfigurationShouldFollowNewConfig(t *testing.T) {
+	logger, err := New(Config{Level: "debug"})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	entry := logger.GetLog("test")
+	assert.NoError(t, logger.configure(Config{Level: "error"}))
+
+	assert.False(t, entry.Logger.IsLevelEnabled(logrus.InfoLevel))
+}
+
+func Test_ConcurrentReconfigurationShouldBeSafe(t *testing.T) {
+	logger, err := New(Config{Level: "debug"})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			level := logrus.AllLevels[i%len(logrus.AllLevels)].String()
+			assert.NoError(t, logger.configure(Config{Level: level, Colors: i%2 == 0}))
+			logger.GetLog("test").Info("Test")
+			logger.GetCS()
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,311 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	netDialTimeout  = 5 * time.Second
+	netWriteTimeout = 10 * time.Second
+	// maxDatagramSize is the largest UDP payload over IPv4.
+	maxDatagramSize = 65507
+)
+
+// TLSConfig encrypts the connection of a DestinationTCP sink when Enabled. The
+// server certificate is verified against the system roots, or CAFile.
+type TLSConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" toml:"enabled"`
+	// CAFile is a PEM file of the certificates the server's must be signed by.
+	CAFile string `json:"ca_file" yaml:"ca_file" toml:"ca_file"`
+	// CertFile and KeyFile are the PEM files of the client certificate, for
+	// servers requiring one.
+	CertFile string `json:"cert_file" yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file" toml:"key_file"`
+	// ServerName defaults to the host of the address.
+	ServerName         string `json:"server_name" yaml:"server_name" toml:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+}
+
+func (config TLSConfig) validate(field string, configErr *ConfigError) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		configErr.add(field+".KeyFile", errors.New("CertFile and KeyFile must be set together"))
+	} else if _, err := config.tlsConfig(); err != nil {
+		configErr.add(field, err)
+	}
+}
+
+// tlsConfig returns the crypto/tls config of config, or nil when disabled.
+func (config TLSConfig) tlsConfig() (*tls.Config, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	retVal := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		retVal.RootCAs = x509.NewCertPool()
+		if !retVal.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", config.CAFile)
+		}
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		retVal.Certificates = []tls.Certificate{cert}
+	}
+	return retVal, nil
+}
+
+// netWriter sends the messages written to it to a TCP or UDP address from a
+// background goroutine, so an unreachable destination doesn't stall the
+// callers. Messages wait in a spool until sent; while the destination is
+// unreachable, the writer reconnects with a backoff and the spool fills up.
+//
+// Each Write is one message: a line for TCP, a datagram for UDP. Syslog
+// messages are sent without their line feed, and framed by octet counting over
+// TCP, per RFC 6587.
+type netWriter struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	syslog    bool
+	backoff   *backoff
+
+	lock    sync.Mutex
+	changed *sync.Cond
+	spool   spool
+	// failing is set while the destination is unreachable.
+	failing bool
+	closed  bool
+	dropped uint64
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func newNetWriter(sink SinkConfig) *netWriter {
+	tlsConfig, _ := sink.TLS.tlsConfig()
+	retVal := &netWriter{
+		network:   string(sink.Destination),
+		address:   sink.Address,
+		tlsConfig: tlsConfig,
+		syslog:    sink.Format == FormatSyslog,
+		backoff:   sink.Reconnect.backoff(),
+		spool:     sink.Spool.open(),
+		wake:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	retVal.changed = sync.NewCond(&retVal.lock)
+
+	go retVal.run()
+
+	return retVal
+}
+
+// Write spools a copy of the message. Messages written while the spool is full
+// are dropped, and reported to errorOutput once the spool is drained. Messages
+// too large for a datagram are dropped and reported right away.
+func (w *netWriter) Write(p []byte) (int, error) {
+	message := w.frame(p)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, ErrSinkClosed
+	}
+	if w.network == string(DestinationUDP) && len(message) > maxDatagramSize {
+		fmt.Fprintf(errorOutput, "Dropped a log entry of %d bytes for %s %s, over the datagram size limit\n", len(message), w.network, w.address)
+		return len(p), nil
+	}
+	spooled, err := w.spool.push(message)
+	if err != nil {
+		return 0, err
+	}
+	if !spooled {
+		w.dropped++
+	}
+	w.changed.Broadcast()
+	return len(p), nil
+}
+
+func (w *netWriter) frame(p []byte) []byte {
+	if w.syslog {
+		p = bytes.TrimSuffix(p, []byte("\n"))
+		if w.network == string(DestinationTCP) {
+			return append([]byte(strconv.Itoa(len(p))+" "), p...)
+		}
+	}
+	return append([]byte(nil), p...)
+}
+
+// Flush waits for the spooled messages to be sent, unless the destination is
+// unreachable.
+func (w *netWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for w.spool.len() > 0 && !w.failing && !w.closed {
+		w.changed.Wait()
+	}
+	return nil
+}
+
+// Close sends the spooled messages unless the destination is unreachable, and
+// stops the writer. Messages left in a spool file are sent by the next writer
+// opening it.
+func (w *netWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.wake)
+	w.changed.Broadcast()
+	w.lock.Unlock()
+
+	<-w.done
+	return w.spool.close()
+}
+
+func (w *netWriter) run() {
+	defer close(w.done)
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		w.lock.Lock()
+		for w.spool.len() == 0 && !w.closed {
+			w.changed.Wait()
+		}
+		closing, failing := w.closed, w.failing
+		if w.spool.len() == 0 || (closing && failing) {
+			w.lock.Unlock()
+			return
+		}
+		messages, err := w.spool.peek(1)
+		if err != nil {
+			fmt.Fprintf(errorOutput, "Failed to read a log entry from the spool, dropping it: %v\n", err)
+			err = w.spool.pop(1)
+		}
+		w.lock.Unlock()
+		if len(messages) == 0 {
+			if err != nil {
+				w.fail(err)
+				w.sleep(w.backoff.next())
+			}
+			continue
+		}
+
+		if conn == nil {
+			conn, err = w.dial()
+		}
+		if err == nil {
+			conn.SetWriteDeadline(time.Now().Add(netWriteTimeout))
+			_, err = conn.Write(messages[0])
+		}
+		if errors.Is(err, syscall.EMSGSIZE) {
+			w.discard(err)
+			continue
+		}
+		if err != nil {
+			if conn != nil {
+				conn.Close()
+				conn = nil
+			}
+			w.fail(err)
+			if !closing {
+				w.sleep(w.backoff.next())
+			}
+			continue
+		}
+
+		w.sent()
+	}
+}
+
+func (w *netWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: netDialTimeout}
+	if w.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, w.network, w.address, w.tlsConfig)
+	}
+	return dialer.Dial(w.network, w.address)
+}
+
+// fail reports the first error of an outage to errorOutput.
+func (w *netWriter) fail(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.failing {
+		fmt.Fprintf(errorOutput, "Failed to send log entries to %s %s, spooling them: %v\n", w.network, w.address, err)
+	}
+	w.failing = true
+	w.changed.Broadcast()
+}
+
+// sent pops the message that was sent, and reports the dropped messages once
+// the spool is drained.
+func (w *netWriter) sent() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.spool.pop(1); err != nil {
+		fmt.Fprintf(errorOutput, "Failed to remove a sent log entry from the spool: %v\n", err)
+	}
+	w.backoff.reset()
+	if w.dropped > 0 && w.spool.len() == 0 {
+		fmt.Fprintf(errorOutput, "%d log entries for %s %s dropped while the spool was full\n", w.dropped, w.network, w.address)
+		w.dropped = 0
+	}
+	w.failing = false
+	w.changed.Broadcast()
+}
+
+// discard pops a message the destination can never accept, so it doesn't
+// block the messages behind it.
+func (w *netWriter) discard(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	fmt.Fprintf(errorOutput, "Failed to send a log entry to %s %s, dropping it: %v\n", w.network, w.address, err)
+	if err := w.spool.pop(1); err != nil {
+		fmt.Fprintf(errorOutput, "Failed to remove a dropped log entry from the spool: %v\n", err)
+	}
+	w.changed.Broadcast()
+}
+
+// sleep waits for delay, or until the writer is closed.
+func (w *netWriter) sleep(delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-w.wake:
+	}
+}
@@ -0,0 +1,388 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TcpSinkShouldSendJsonLines(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	logger := newNetSinkLogger(t, SinkConfig{Destination: DestinationTCP, Address: listener.Addr().String()})
+	logger.GetLog("db").Warn("connected")
+	logger.GetLog("db").Error("slow")
+
+	lines := acceptLines(t, listener)
+	entry := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal([]byte(<-lines), &entry))
+	assert.Equal(t, "connected", entry["message"])
+	assert.Equal(t, "eu", entry["dc"])
+	assert.Equal(t, map[string]interface{}{"obj": "db"}, entry["data"])
+	assert.Contains(t, <-lines, `"message":"slow"`)
+}
+
+func Test_TcpSinkShouldFrameSyslogMessages(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	logger := newNetSinkLogger(t, SinkConfig{
+		Destination:  DestinationTCP,
+		Address:      listener.Addr().String(),
+		Format:       FormatSyslog,
+		Facility:     "local0",
+		EnterpriseId: "99999.1",
+	})
+	logger.GetLog("db").Error("down")
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	length, err := reader.ReadString(' ')
+	assert.NoError(t, err)
+	size, err := strconv.Atoi(strings.TrimSpace(length))
+	assert.NoError(t, err)
+	message := make([]byte, size)
+	_, err = reader.Read(message)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<131>1 \S+ host-1 app \d+ db \[logger@99999\.1 HOSTNAME="host-1" dc="eu"\] down$`, string(message))
+}
+
+func Test_UdpSinkShouldSendDatagrams(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	logger := newNetSinkLogger(t, SinkConfig{Destination: DestinationUDP, Address: conn.LocalAddr().String(), Format: FormatSyslog})
+	logger.GetLog("db").Warn("connected")
+
+	datagram := make([]byte, 65536)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(datagram)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<12>1 .* connected$`, string(datagram[:n]))
+}
+
+func Test_UdpSinkShouldDropMessagesTooLargeForADatagram(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	stderr := captureErrorOutput(t)
+
+	writer := newNetWriter(SinkConfig{Destination: DestinationUDP, Address: conn.LocalAddr().String()})
+	defer writer.Close()
+	_, err = writer.Write(bytes.Repeat([]byte("a"), maxDatagramSize+1))
+	assert.NoError(t, err)
+	writer.lock.Lock()
+	_, err = writer.spool.push(bytes.Repeat([]byte("b"), maxDatagramSize+1))
+	writer.lock.Unlock()
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("small"))
+	assert.NoError(t, err)
+
+	datagram := make([]byte, 65536)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(datagram)
+	assert.NoError(t, err)
+	assert.Equal(t, "small", string(datagram[:n]))
+	assert.Contains(t, stderr.String(), "over the datagram size limit")
+	assert.Contains(t, stderr.String(), "dropping it")
+}
+
+func Test_TcpSinkShouldSpoolAndReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+	stderr := captureErrorOutput(t)
+
+	logger := newNetSinkLogger(t, SinkConfig{
+		Destination: DestinationTCP,
+		Address:     address,
+		Reconnect:   BackoffConfig{MinDelay: "10ms", MaxDelay: "20ms"},
+	})
+	logger.GetLog("db").Warn("first")
+	logger.GetLog("db").Warn("second")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(stderr.String(), "Failed to send log entries to tcp "+address)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	listener, err = net.Listen("tcp", address)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	lines := acceptLines(t, listener)
+	assert.Contains(t, <-lines, `"message":"first"`)
+	assert.Contains(t, <-lines, `"message":"second"`)
+}
+
+func Test_FileSpoolShouldKeepMessagesAcrossWriters(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "spool")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+	captureErrorOutput(t)
+
+	sink := SinkConfig{
+		Destination: DestinationTCP,
+		Address:     address,
+		Spool:       SpoolConfig{Path: fileName},
+		Reconnect:   BackoffConfig{MinDelay: "10ms", MaxDelay: "20ms"},
+	}
+	writer := newNetWriter(sink)
+	_, err = writer.Write([]byte("first\n"))
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("second\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	listener, err = net.Listen("tcp", address)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	writer = newNetWriter(sink)
+	defer writer.Close()
+	lines := acceptLines(t, listener)
+	assert.Equal(t, "first", <-lines)
+	assert.Equal(t, "second", <-lines)
+	assert.NoError(t, writer.Flush())
+	info, err := os.Stat(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(fileSpoolHeaderSize), info.Size())
+}
+
+func Test_SpoolsShouldBeBounded(t *testing.T) {
+	file, err := openFileSpool(filepath.Join(t.TempDir(), "spool"), 18)
+	assert.NoError(t, err)
+	defer file.close()
+
+	for _, s := range []spool{&memorySpool{maxSize: 10}, file} {
+		spooled, err := s.push([]byte("12345"))
+		assert.NoError(t, err)
+		assert.True(t, spooled)
+		spooled, err = s.push([]byte("678901"))
+		assert.NoError(t, err)
+		assert.False(t, spooled)
+
+		spooled, err = s.push([]byte("6789"))
+		assert.NoError(t, err)
+		assert.True(t, spooled)
+		assert.Equal(t, 2, s.len())
+		assert.Equal(t, int64(9), s.size())
+
+		messages, err := s.peek(3)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("12345"), []byte("6789")}, messages)
+		assert.NoError(t, s.pop(1))
+		messages, err = s.peek(3)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("6789")}, messages)
+		assert.NoError(t, s.pop(1))
+		assert.Equal(t, 0, s.len())
+	}
+}
+
+func Test_FileSpoolShouldReuseTheRoomOfPoppedMessages(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "spool")
+	s, err := openFileSpool(fileName, 1024)
+	assert.NoError(t, err)
+	defer func() { s.close() }()
+
+	message := bytes.Repeat([]byte("a"), 100)
+	for i := 0; i < 100; i++ {
+		spooled, err := s.push(message)
+		assert.NoError(t, err)
+		assert.True(t, spooled)
+		if i > 0 {
+			assert.NoError(t, s.pop(1))
+		}
+	}
+	assert.Equal(t, 1, s.len())
+	info, err := os.Stat(fileName)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(fileSpoolHeaderSize+2*1024))
+
+	assert.NoError(t, s.close())
+	s, err = openFileSpool(fileName, 1024)
+	assert.NoError(t, err)
+	messages, err := s.peek(2)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{message}, messages)
+}
+
+func Test_TcpSinkShouldUseTls(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	logger := newNetSinkLogger(t, SinkConfig{
+		Destination: DestinationTCP,
+		Address:     listener.Addr().String(),
+		TLS:         TLSConfig{Enabled: true, CAFile: certFile},
+	})
+	logger.GetLog("db").Warn("encrypted")
+
+	assert.Contains(t, <-acceptLines(t, listener), `"message":"encrypted"`)
+}
+
+func Test_NetSinksShouldBeValidated(t *testing.T) {
+	config := Config{Level: "info", Sinks: []SinkConfig{
+		{Destination: DestinationTCP, Address: "localhost", Reconnect: BackoffConfig{MinDelay: "soon"}},
+		{Destination: DestinationUDP, Address: "localhost:514", TLS: TLSConfig{Enabled: true}, Format: FormatSyslog, Facility: "local9"},
+	}}
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(config.Validate(), &configErr))
+	fields := make([]string, len(configErr.Problems))
+	for i, problem := range configErr.Problems {
+		fields[i] = problem.Field
+	}
+	assert.Equal(t, []string{"Sinks[0].Address", "Sinks[0].Reconnect.MinDelay", "Sinks[1].TLS", "Sinks[1].Facility"}, fields)
+}
+
+func Test_BackoffShouldDoubleUpToMax(t *testing.T) {
+	b := BackoffConfig{MinDelay: "100ms", MaxDelay: "1s"}.backoff()
+
+	for _, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		delay := b.next()
+		assert.LessOrEqual(t, delay, max*time.Millisecond)
+		assert.GreaterOrEqual(t, delay, max*time.Millisecond/2)
+	}
+	b.reset()
+	assert.LessOrEqual(t, b.next(), 100*time.Millisecond)
+}
+
+// newNetSinkLogger creates a Logger with the given sink at warn level, which
+// the entry reporting the configuration doesn't reach.
+func newNetSinkLogger(t *testing.T, sink SinkConfig) *Logger {
+	sink.Level = "warn"
+	logger, err := New(Config{
+		AppName:          "app",
+		Level:            "info",
+		AdditionalFields: LoggerFields{Hostname: "host-1", Dc: "eu"},
+		Sinks:            []SinkConfig{sink},
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+// acceptLines accepts a connection on listener and returns its lines.
+func acceptLines(t *testing.T, listener net.Listener) <-chan string {
+	lines := make(chan string, 100)
+	go func() {
+		defer close(lines)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	retVal := make(chan string)
+	go func() {
+		defer close(retVal)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+				retVal <- line
+			case <-time.After(5 * time.Second):
+				t.Error("no line received")
+				return
+			}
+		}
+	}()
+	return retVal
+}
+
+// captureErrorOutput collects what the background writers report until the
+// test ends.
+func captureErrorOutput(t *testing.T) *lockedBuffer {
+	previous := errorOutput
+	retVal := &lockedBuffer{}
+	errorOutput = retVal
+	t.Cleanup(func() { errorOutput = previous })
+	return retVal
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buffer.String()
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and its
+// key, and returns their files.
+func writeTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldNameObj is the field GetLog tags entries with.
+const FieldNameObj = "obj"
+
+// objLevels decides whether an entry is logged based on its obj field. An obj
+// is matched against the exact names first and then against the patterns,
+// where '*' matches any sequence of characters (e.g. "db.*" or "*_worker").
+// The most specific pattern, the one with the most literal characters, wins.
+// Entries matching nothing use the global level.
+type objLevels struct {
+	global   logrus.Level
+	exact    map[string]logrus.Level
+	patterns []objLevelPattern
+}
+
+type objLevelPattern struct {
+	pattern string
+	level   logrus.Level
+}
+
+func newObjLevels(global logrus.Level, levels map[string]string) (*objLevels, error) {
+	retVal := &objLevels{
+		global: global,
+		exact:  make(map[string]logrus.Level),
+	}
+
+	for obj, levelStr := range levels {
+		level, err := logrus.ParseLevel(levelStr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", obj, err)
+		}
+		if strings.Contains(obj, "*") {
+			retVal.patterns = append(retVal.patterns, objLevelPattern{pattern: obj, level: level})
+		} else {
+			retVal.exact[obj] = level
+		}
+	}
+
+	sort.Slice(retVal.patterns, func(i, j int) bool {
+		return moreSpecificPattern(retVal.patterns[i].pattern, retVal.patterns[j].pattern)
+	})
+
+	return retVal, nil
+}
+
+// level returns the level configured for obj.
+func (o *objLevels) level(obj string) logrus.Level {
+	if level, found := o.exact[obj]; found {
+		return level
+	}
+	for _, pattern := range o.patterns {
+		if matchObjPattern(pattern.pattern, obj) {
+			return pattern.level
+		}
+	}
+	return o.global
+}
+
+func (o *objLevels) allows(entry *logrus.Entry) bool {
+	obj, _ := entry.Data[FieldNameObj].(string)
+	return entry.Level <= o.level(obj)
+}
+
+// mostVerbose returns the most verbose level any obj may log at, which is the
+// level the logrus logger must be set to for the entries to be created at all.
+func (o *objLevels) mostVerbose() logrus.Level {
+	retVal := o.global
+	for _, level := range o.exact {
+		if level > retVal {
+			retVal = level
+		}
+	}
+	for _, pattern := range o.patterns {
+		if pattern.level > retVal {
+			retVal = pattern.level
+		}
+	}
+	return retVal
+}
+
+// moreSpecificPattern orders patterns by their number of literal characters,
+// most first, and then lexically.
+func moreSpecificPattern(left string, right string) bool {
+	leftLiterals, rightLiterals := len(left)-strings.Count(left, "*"), len(right)-strings.Count(right, "*")
+	if leftLiterals != rightLiterals {
+		return leftLiterals > rightLiterals
+	}
+	return left < right
+}
+
+// matchObjPattern matches value against pattern, where '*' matches any sequence
+// of characters.
+func matchObjPattern(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := len(parts) - 1
+	for _, part := range parts[1:last] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return len(value) >= len(parts[last]) && strings.HasSuffix(value, parts[last])
+}
+
+// filteringFormatter skips the console output of entries filtered out by the
+// per-obj levels.
+type filteringFormatter struct {
+	logrus.Formatter
+	dispatcher *dispatcher
+}
+
+func (f *filteringFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !f.dispatcher.allows(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// skipEmptyWrites is the console output of a Logger. It drops the empty writes
+// logrus makes for the entries skipped by filteringFormatter, which would cost
+// a write per entry in the hot loops the stages filter.
+type skipEmptyWrites struct {
+	io.Writer
+}
+
+func (w skipEmptyWrites) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return w.Writer.Write(p)
+}
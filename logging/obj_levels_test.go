@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"path"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ObjLevelsShouldPreferExactThenMostSpecificPattern(t *testing.T) {
+	levels, err := newObjLevels(logrus.InfoLevel, map[string]string{
+		"db":        "warn",
+		"db*":       "error",
+		"db.pool.*": "trace",
+		"*_worker":  "debug",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, logrus.WarnLevel, levels.level("db"))
+	assert.Equal(t, logrus.ErrorLevel, levels.level("db.query"))
+	assert.Equal(t, logrus.TraceLevel, levels.level("db.pool.conn"))
+	assert.Equal(t, logrus.DebugLevel, levels.level("queue_worker"))
+	assert.Equal(t, logrus.InfoLevel, levels.level("http"))
+	assert.Equal(t, logrus.TraceLevel, levels.mostVerbose())
+}
+
+func Test_MatchObjPattern(t *testing.T) {
+	assert.True(t, matchObjPattern("http.*", "http.server"))
+	assert.True(t, matchObjPattern("*", ""))
+	assert.True(t, matchObjPattern("a*b*c", "a-b-b-c"))
+	assert.False(t, matchObjPattern("a*a", "a"))
+	assert.False(t, matchObjPattern("http.*", "https"))
+}
+
+func Test_ObjLevelsShouldFilterConsoleAndJsonFile(t *testing.T) {
+	folder := t.TempDir()
+	logger, err := New(Config{
+		Level:         "info",
+		AppName:       appName,
+		LogsFolder:    folder,
+		LogToJsonFile: true,
+		ObjLevels:     map[string]string{"db": "warn", "http": "trace"},
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+	console := new(bytes.Buffer)
+	logger.setOutput(console)
+
+	logger.GetLog("db").Info("filtered")
+	logger.GetLog("http").Trace("http trace")
+	logger.GetLog("worker").Debug("filtered")
+	logger.GetLog("worker").Info("worker info")
+
+	assert.NotContains(t, console.String(), "filtered")
+	assert.Contains(t, console.String(), "http trace")
+	assert.Contains(t, console.String(), "worker info")
+	entries := loadLogFile(path.Join(folder, appName+"_logstash_json.log"))
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "http trace", entries[1]["message"])
+	assert.Equal(t, "worker info", entries[2]["message"])
+}
+
+func Test_SetObjLevelShouldSilenceOneComponentAtRuntime(t *testing.T) {
+	logger, err := New(Config{Level: "debug"})
+	assert.NoError(t, err)
+	console := new(bytes.Buffer)
+	logger.setOutput(console)
+
+	assert.NoError(t, logger.SetObjLevel("noisy", "error"))
+	logger.GetLog("noisy").Warn("filtered")
+	logger.GetLog("other").Debug("other debug")
+
+	assert.NotContains(t, console.String(), "filtered")
+	assert.Contains(t, console.String(), "other debug")
+	assert.Contains(t, console.String(), `obj \"noisy\" level \"\" -> \"error\"`)
+
+	assert.NoError(t, logger.ClearObjLevel("noisy"))
+	logger.GetLog("noisy").Warn("noisy again")
+	assert.Contains(t, console.String(), "noisy again")
+}
+
+func Test_SetObjLevelShouldRejectInvalidLevels(t *testing.T) {
+	logger, err := New(Config{Level: "debug"})
+	assert.NoError(t, err)
+
+	assert.Error(t, logger.SetObjLevel("db", "loud"))
+	assert.Empty(t, logger.config.ObjLevels)
+}
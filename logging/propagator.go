@@ -0,0 +1,273 @@
+package logging
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Carrier holds the headers of a call, e.g. an http.Header or a MapCarrier
+// holding the headers of a message.
+type Carrier interface {
+	Get(key string) string
+	Set(key string, value string)
+}
+
+// MapCarrier is a Carrier of message headers. Its keys are matched without
+// case and written lowercase.
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string {
+	if value, found := c[key]; found {
+		return value
+	}
+	for k, value := range c {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (c MapCarrier) Set(key string, value string) {
+	for k := range c {
+		if strings.EqualFold(k, key) {
+			delete(c, k)
+		}
+	}
+	c[strings.ToLower(key)] = value
+}
+
+// Propagator sends the context of a trace with the calls it makes, and
+// continues the traces of the calls received.
+type Propagator interface {
+	// Inject writes the context of the segment making a call into the
+	// carrier. It writes nothing when the context can't be expressed in the
+	// format of the propagator.
+	Inject(segment Segment, carrier Carrier)
+	// Extract returns the context of the caller, which Logger.ExtractTrace
+	// continues. The ParentId is empty when the format doesn't carry it.
+	Extract(carrier Carrier) (TraceParent, TraceState, bool)
+}
+
+// TraceInjector is implemented by the propagators able to send the context of
+// a trace from outside of its segments, which is only its id.
+type TraceInjector interface {
+	// InjectTrace writes the context of the trace making a call into the
+	// carrier.
+	InjectTrace(trace Trace, carrier Carrier)
+}
+
+// ExtractTrace continues the trace of the caller extracted from the carrier by
+// the propagator, or starts a new one when there is none.
+func (l *Logger) ExtractTrace(propagator Propagator, action string, carrier Carrier) Trace {
+	parent, state, ok := propagator.Extract(carrier)
+	if !ok {
+		return l.NewTrace(action)
+	}
+	return l.ContinueTrace(action, parent, state)
+}
+
+// ExtractTrace continues the trace of the caller through the default Logger,
+// see Logger.ExtractTrace.
+func ExtractTrace(propagator Propagator, action string, carrier Carrier) Trace {
+	return std.ExtractTrace(propagator, action, carrier)
+}
+
+// propagatedContext returns the W3C Trace Context sent by the segment, unless
+// its trace doesn't use W3C ids.
+func propagatedContext(segment Segment) (TraceParent, bool) {
+	parent, ok := segment.TraceParent()
+	return parent, ok && isHexId(parent.TraceId, 32) && isHexId(parent.ParentId, 16)
+}
+
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// W3CPropagator propagates the traceparent and tracestate headers of the W3C
+// Trace Context. An invalid tracestate is dropped.
+type W3CPropagator struct{}
+
+func (W3CPropagator) Inject(segment Segment, carrier Carrier) {
+	parent, ok := propagatedContext(segment)
+	if !ok {
+		return
+	}
+	carrier.Set(HeaderTraceParent, parent.String())
+	if state := segment.Parent().TraceState().String(); state != "" {
+		carrier.Set(HeaderTraceState, state)
+	}
+}
+
+func (W3CPropagator) Extract(carrier Carrier) (TraceParent, TraceState, bool) {
+	parent, err := ParseTraceParent(carrier.Get(HeaderTraceParent))
+	if err != nil {
+		return TraceParent{}, TraceState{}, false
+	}
+	state, err := ParseTraceState(carrierValues(carrier, HeaderTraceState)...)
+	if err != nil {
+		state = TraceState{}
+	}
+	return parent, state, true
+}
+
+// carrierValues returns all the values of the key, which an http.Header can
+// hold several times.
+func carrierValues(carrier Carrier, key string) []string {
+	if header, ok := carrier.(http.Header); ok {
+		return header.Values(key)
+	}
+	return []string{carrier.Get(key)}
+}
+
+const (
+	HeaderB3        = "b3"
+	HeaderB3TraceId = "X-B3-TraceId"
+	HeaderB3SpanId  = "X-B3-SpanId"
+	HeaderB3Sampled = "X-B3-Sampled"
+	HeaderB3Flags   = "X-B3-Flags"
+)
+
+// B3SinglePropagator propagates the b3 header of Zipkin, e.g.
+// b3: 80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1. The 64 bits trace
+// ids are padded to 128 bits.
+type B3SinglePropagator struct{}
+
+func (B3SinglePropagator) Inject(segment Segment, carrier Carrier) {
+	parent, ok := propagatedContext(segment)
+	if !ok {
+		return
+	}
+	carrier.Set(HeaderB3, parent.TraceId+"-"+parent.ParentId+"-"+b3Sampling(parent.Sampled))
+}
+
+func (B3SinglePropagator) Extract(carrier Carrier) (TraceParent, TraceState, bool) {
+	// The sampling decision alone, e.g. "b3: 0", carries no trace.
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(carrier.Get(HeaderB3))), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return TraceParent{}, TraceState{}, false
+	}
+	sampled := false
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1", "d":
+			sampled = true
+		case "0":
+		default:
+			return TraceParent{}, TraceState{}, false
+		}
+	}
+	return b3Context(parts[0], parts[1], sampled)
+}
+
+// B3MultiPropagator propagates the X-B3-TraceId, X-B3-SpanId and X-B3-Sampled
+// headers of Zipkin. The 64 bits trace ids are padded to 128 bits.
+type B3MultiPropagator struct{}
+
+func (B3MultiPropagator) Inject(segment Segment, carrier Carrier) {
+	parent, ok := propagatedContext(segment)
+	if !ok {
+		return
+	}
+	carrier.Set(HeaderB3TraceId, parent.TraceId)
+	carrier.Set(HeaderB3SpanId, parent.ParentId)
+	carrier.Set(HeaderB3Sampled, b3Sampling(parent.Sampled))
+}
+
+func (B3MultiPropagator) Extract(carrier Carrier) (TraceParent, TraceState, bool) {
+	sampled := carrier.Get(HeaderB3Flags) == "1"
+	switch strings.ToLower(carrier.Get(HeaderB3Sampled)) {
+	case "1", "true":
+		sampled = true
+	}
+	return b3Context(strings.ToLower(carrier.Get(HeaderB3TraceId)), strings.ToLower(carrier.Get(HeaderB3SpanId)), sampled)
+}
+
+func b3Context(traceId string, spanId string, sampled bool) (TraceParent, TraceState, bool) {
+	if len(traceId) == 16 {
+		traceId = strings.Repeat("0", 16) + traceId
+	}
+	if !isHexId(traceId, 32) || !isHexId(spanId, 16) {
+		return TraceParent{}, TraceState{}, false
+	}
+	return TraceParent{TraceId: traceId, ParentId: spanId, Sampled: sampled}, TraceState{}, true
+}
+
+func b3Sampling(sampled bool) string {
+	if sampled {
+		return "1"
+	}
+	return "0"
+}
+
+// maxHeaderIdLength bounds the trace ids extracted by HeaderIdPropagator.
+const maxHeaderIdLength = 128
+
+// HeaderIdPropagator propagates the trace id alone in Header, e.g. the
+// X-Request-Id of a proxy. Values of up to 128 letters, digits, '.', '_' and
+// '-' are used as trace id, other values are ignored.
+type HeaderIdPropagator struct {
+	Header string
+}
+
+func (p HeaderIdPropagator) Inject(segment Segment, carrier Carrier) {
+	p.InjectTrace(segment.Parent(), carrier)
+}
+
+func (p HeaderIdPropagator) InjectTrace(trace Trace, carrier Carrier) {
+	carrier.Set(p.Header, trace.Id())
+}
+
+func (p HeaderIdPropagator) Extract(carrier Carrier) (TraceParent, TraceState, bool) {
+	id := strings.TrimSpace(carrier.Get(p.Header))
+	if !isHeaderId(id) {
+		return TraceParent{}, TraceState{}, false
+	}
+	return TraceParent{TraceId: id, Sampled: true}, TraceState{}, true
+}
+
+// isHeaderId reports whether id can be used as trace id, and echoed back to
+// the caller.
+func isHeaderId(id string) bool {
+	if id == "" || len(id) > maxHeaderIdLength {
+		return false
+	}
+	for _, char := range id {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case char == '.' || char == '_' || char == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CompositePropagator injects the context of the segment with all its
+// propagators, and extracts it with the first one finding a trace. The context
+// of a trace is injected by those implementing TraceInjector.
+type CompositePropagator []Propagator
+
+func (c CompositePropagator) Inject(segment Segment, carrier Carrier) {
+	for _, propagator := range c {
+		propagator.Inject(segment, carrier)
+	}
+}
+
+func (c CompositePropagator) InjectTrace(trace Trace, carrier Carrier) {
+	for _, propagator := range c {
+		if injector, ok := propagator.(TraceInjector); ok {
+			injector.InjectTrace(trace, carrier)
+		}
+	}
+}
+
+func (c CompositePropagator) Extract(carrier Carrier) (TraceParent, TraceState, bool) {
+	for _, propagator := range c {
+		if parent, state, ok := propagator.Extract(carrier); ok {
+			return parent, state, true
+		}
+	}
+	return TraceParent{}, TraceState{}, false
+}
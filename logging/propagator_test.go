@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testTraceId  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentId = "00f067aa0ba902b7"
+)
+
+func Test_PropagatorsShouldExtractTheTraceOfTheCaller(t *testing.T) {
+	tests := []struct {
+		name       string
+		propagator Propagator
+		carrier    Carrier
+		expected   TraceParent
+	}{
+		{"w3c", W3CPropagator{},
+			http.Header{"Traceparent": {"00-" + testTraceId + "-" + testParentId + "-01"}},
+			TraceParent{TraceId: testTraceId, ParentId: testParentId, Sampled: true}},
+		{"b3 single", B3SinglePropagator{},
+			MapCarrier{"b3": testTraceId + "-" + testParentId + "-d-" + testParentId},
+			TraceParent{TraceId: testTraceId, ParentId: testParentId, Sampled: true}},
+		{"b3 single 64 bits", B3SinglePropagator{},
+			MapCarrier{"B3": "a3ce929d0e0e4736-" + testParentId},
+			TraceParent{TraceId: "0000000000000000a3ce929d0e0e4736", ParentId: testParentId}},
+		{"b3 multi", B3MultiPropagator{},
+			http.Header{"X-B3-Traceid": {testTraceId}, "X-B3-Spanid": {testParentId}, "X-B3-Sampled": {"0"}},
+			TraceParent{TraceId: testTraceId, ParentId: testParentId}},
+		{"b3 multi debug", B3MultiPropagator{},
+			MapCarrier{"x-b3-traceid": testTraceId, "x-b3-spanid": testParentId, "x-b3-flags": "1"},
+			TraceParent{TraceId: testTraceId, ParentId: testParentId, Sampled: true}},
+		{"header id", HeaderIdPropagator{Header: "X-Request-Id"},
+			MapCarrier{"x-request-id": "req-1"},
+			TraceParent{TraceId: "req-1", Sampled: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent, state, ok := test.propagator.Extract(test.carrier)
+
+			assert.True(t, ok)
+			assert.Equal(t, test.expected, parent)
+			assert.Equal(t, TraceState{}, state)
+		})
+	}
+}
+
+func Test_PropagatorsShouldIgnoreMissingOrInvalidHeaders(t *testing.T) {
+	carriers := []MapCarrier{
+		{},
+		{"traceparent": "00-" + testTraceId + "-" + testParentId},
+		{"b3": "1"},
+		{"b3": testTraceId + "-" + testParentId + "-x"},
+		{"x-b3-traceid": testTraceId},
+		{"x-request-id": " "},
+		{"x-request-id": "<script>"},
+		{"x-request-id": "req 1"},
+		{"x-request-id": strings.Repeat("a", 129)},
+	}
+	propagator := CompositePropagator{W3CPropagator{}, B3SinglePropagator{}, B3MultiPropagator{}, HeaderIdPropagator{Header: "X-Request-Id"}}
+
+	for _, carrier := range carriers {
+		_, _, ok := propagator.Extract(carrier)
+		assert.False(t, ok, carrier)
+	}
+}
+
+func Test_PropagatorsShouldInjectTheContextOfTheSegment(t *testing.T) {
+	_, entry := newTestLogger()
+	state, _ := ParseTraceState("congo=t61rcWkgMzE")
+	trace := ContinueTrace("checkout", TraceParent{TraceId: testTraceId, ParentId: testParentId, Sampled: true}, state, entry)
+	segment := trace.StartSegment("pay")
+
+	header := http.Header{}
+	CompositePropagator{W3CPropagator{}, B3MultiPropagator{}, HeaderIdPropagator{Header: "X-Request-Id"}}.Inject(segment, header)
+	assert.Equal(t, http.Header{
+		"Traceparent":  {"00-" + testTraceId + "-" + segment.Id() + "-01"},
+		"Tracestate":   {"congo=t61rcWkgMzE"},
+		"X-B3-Traceid": {testTraceId},
+		"X-B3-Spanid":  {segment.Id()},
+		"X-B3-Sampled": {"1"},
+		"X-Request-Id": {testTraceId},
+	}, header)
+
+	message := MapCarrier{"B3": "stale"}
+	B3SinglePropagator{}.Inject(segment, message)
+	assert.Equal(t, MapCarrier{"b3": testTraceId + "-" + segment.Id() + "-1"}, message)
+}
+
+func Test_PropagatorsShouldOnlyInjectWhatTheirFormatExpresses(t *testing.T) {
+	_, entry := newTestLogger()
+	trace := NewTrace("checkout", entry)
+	segment := trace.StartSegment("pay")
+
+	carrier := MapCarrier{}
+	CompositePropagator{W3CPropagator{}, B3SinglePropagator{}, HeaderIdPropagator{Header: "X-Request-Id"}}.Inject(segment, carrier)
+	assert.Equal(t, MapCarrier{"x-request-id": trace.Id()}, carrier)
+}
+
+func Test_PropagatorsShouldInjectTheIdOfATrace(t *testing.T) {
+	_, entry := newTestLogger()
+	trace := ContinueTrace("checkout", TraceParent{TraceId: testTraceId, ParentId: testParentId, Sampled: true}, TraceState{}, entry)
+
+	carrier := MapCarrier{}
+	CompositePropagator{W3CPropagator{}, HeaderIdPropagator{Header: "X-Request-Id"}}.InjectTrace(trace, carrier)
+	assert.Equal(t, MapCarrier{"x-request-id": testTraceId}, carrier)
+}
+
+func Test_W3CPropagatorShouldExtractTheTraceState(t *testing.T) {
+	parent, state, ok := W3CPropagator{}.Extract(http.Header{
+		"Traceparent": {"00-" + testTraceId + "-" + testParentId + "-01"},
+		"Tracestate":  {"congo=t61rcWkgMzE", "rojo=00f067aa0ba902b7"},
+	})
+
+	assert.True(t, ok)
+	assert.Equal(t, testParentId, parent.ParentId)
+	assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", state.String())
+}
+
+func Test_ExtractTraceShouldContinueTheTraceOfTheCaller(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info"})
+	propagator := CompositePropagator{W3CPropagator{}, HeaderIdPropagator{Header: "X-Request-Id"}}
+
+	trace := logger.ExtractTrace(propagator, "checkout", http.Header{
+		"Traceparent":  {"00-" + testTraceId + "-" + testParentId + "-00"},
+		"X-Request-Id": {"req-1"},
+	})
+	trace.StartSegment("pay")
+	assert.Equal(t, testTraceId, console.last()[FieldNameTraceId])
+	assert.Equal(t, "checkout", console.last()[FieldNameAction])
+	assert.Equal(t, testParentId, console.last()[FieldNameParentSegmentId])
+	assert.False(t, trace.Sampled())
+
+	trace = logger.ExtractTrace(propagator, "checkout", http.Header{"X-Request-Id": {"req-1"}})
+	trace.StartSegment("pay")
+	assert.Equal(t, "req-1", console.last()[FieldNameTraceId])
+	assert.NotContains(t, console.last(), FieldNameParentSegmentId)
+
+	trace = logger.ExtractTrace(propagator, "checkout", http.Header{})
+	assert.NotEmpty(t, trace.Id())
+	_, continued := trace.TraceParent()
+	assert.False(t, continued)
+}
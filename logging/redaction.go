@@ -0,0 +1,295 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactionMode is what redaction does with a sensitive value.
+type RedactionMode string
+
+const (
+	// RedactMask replaces a sensitive value with "[REDACTED]".
+	RedactMask RedactionMode = "mask"
+	// RedactHash replaces a sensitive value with the HMAC-SHA256 of it keyed by
+	// RedactionConfig.HashKey, so equal values can still be correlated.
+	RedactHash RedactionMode = "hash"
+	// RedactDrop removes a sensitive field, or a sensitive part of a message.
+	RedactDrop RedactionMode = "drop"
+)
+
+// The value detectors of RedactionConfig.Values.
+const (
+	DetectEmail      = "email"
+	DetectJWT        = "jwt"
+	DetectCreditCard = "credit_card"
+)
+
+const redactedMask = "[REDACTED]"
+
+// RedactionConfig removes sensitive data from the entries before any sink
+// writes them. Fields are redacted when their key matches one of Keys, a
+// case-insensitive pattern where '*' matches any sequence of characters (e.g.
+// "password", "authorization" or "*_token"), in the fields of the entry and in
+// the maps nested in them. Strings in the fields and the message are redacted
+// where one of the Values detectors matches:
+//
+//	{"keys": ["password", "*_token"], "values": ["email", "jwt", "credit_card"], "mode": "hash", "hash_key": "..."}
+type RedactionConfig struct {
+	Keys []string `json:"keys" yaml:"keys" toml:"keys" env:"KEYS"`
+	// Values are the detectors of sensitive values: DetectEmail, DetectJWT and
+	// DetectCreditCard, which only matches numbers passing the Luhn check.
+	Values []string `json:"values" yaml:"values" toml:"values" env:"VALUES"`
+	// Mode defaults to RedactMask.
+	Mode RedactionMode `json:"mode" yaml:"mode" toml:"mode" env:"MODE"`
+	// HashKey is the HMAC key of RedactHash.
+	HashKey string `json:"hash_key" yaml:"hash_key" toml:"hash_key" env:"HASH_KEY"`
+}
+
+// String masks the HashKey, so that printing the config, e.g. in the log of the
+// configuration, doesn't leak it.
+func (config RedactionConfig) String() string {
+	if config.HashKey != "" {
+		config.HashKey = "***"
+	}
+	type plain RedactionConfig
+	return fmt.Sprint(plain(config))
+}
+
+func (config RedactionConfig) validate(field string, configErr *ConfigError) {
+	for i, value := range config.Values {
+		if _, found := valueDetectors[value]; !found {
+			configErr.add(fmt.Sprintf("%s.Values[%d]", field, i), fmt.Errorf("unknown value detector %q", value))
+		}
+	}
+
+	switch config.Mode {
+	case "", RedactMask, RedactDrop:
+	case RedactHash:
+		if config.HashKey == "" {
+			configErr.add(field+".HashKey", errors.New("required by the hash mode"))
+		}
+	default:
+		configErr.add(field+".Mode", fmt.Errorf("unknown redaction mode %q", config.Mode))
+	}
+}
+
+func (config RedactionConfig) copy() RedactionConfig {
+	config.Keys = append([]string(nil), config.Keys...)
+	config.Values = append([]string(nil), config.Values...)
+	return config
+}
+
+// valueDetector finds a kind of sensitive value in a string.
+type valueDetector struct {
+	pattern *regexp.Regexp
+	// valid, when set, filters the matches of pattern.
+	valid func(match string) bool
+}
+
+var valueDetectors = map[string]valueDetector{
+	DetectEmail: {pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	DetectJWT:   {pattern: regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)},
+	DetectCreditCard: {
+		pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid:   luhnValid,
+	},
+}
+
+// luhnValid reports whether the digits of number pass the Luhn check.
+func luhnValid(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			continue
+		}
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// redactor applies a RedactionConfig to entries.
+type redactor struct {
+	keys      []string
+	detectors []valueDetector
+	mode      RedactionMode
+	hashKey   []byte
+}
+
+// newRedactor returns the redactor of config, or nil when config redacts
+// nothing.
+func newRedactor(config RedactionConfig) *redactor {
+	if len(config.Keys) == 0 && len(config.Values) == 0 {
+		return nil
+	}
+
+	retVal := &redactor{
+		mode:    config.Mode,
+		hashKey: []byte(config.HashKey),
+	}
+	if retVal.mode == "" {
+		retVal.mode = RedactMask
+	}
+	for _, key := range config.Keys {
+		retVal.keys = append(retVal.keys, strings.ToLower(key))
+	}
+	for _, value := range config.Values {
+		retVal.detectors = append(retVal.detectors, valueDetectors[value])
+	}
+	return retVal
+}
+
+// redact redacts the fields and the message of entry in place. The fields map
+// must belong to entry, as the maps of a logged entry do; nested maps are
+// copied rather than modified.
+func (r *redactor) redact(entry *logrus.Entry) {
+	r.redactFields(entry.Data)
+	entry.Message, _ = r.redactString(entry.Message)
+	if err := segmentError(entry.Context); err != nil {
+		if redacted, sensitive := r.redactError(err); sensitive {
+			entry.Context = withSegmentError(entry.Context, redacted)
+		}
+	}
+}
+
+func (r *redactor) redactFields(fields map[string]interface{}) {
+	for key, value := range fields {
+		if r.sensitiveKey(key) {
+			if r.mode == RedactDrop {
+				delete(fields, key)
+			} else {
+				fields[key] = r.replacement(fmt.Sprint(value))
+			}
+			continue
+		}
+
+		redacted, sensitive := r.redactValue(value)
+		if sensitive && r.mode == RedactDrop {
+			delete(fields, key)
+		} else {
+			fields[key] = redacted
+		}
+	}
+}
+
+// redactValue returns value with its sensitive parts redacted, and whether it
+// had any.
+func (r *redactor) redactValue(value interface{}) (interface{}, bool) {
+	switch typed := value.(type) {
+	case string:
+		return r.redactString(typed)
+	case error:
+		return r.redactError(typed)
+	case logrus.Fields:
+		nested := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			nested[key] = value
+		}
+		r.redactFields(nested)
+		return logrus.Fields(nested), false
+	case map[string]interface{}:
+		nested := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			nested[key] = value
+		}
+		r.redactFields(nested)
+		return nested, false
+	case map[string]string:
+		nested := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			nested[key] = value
+		}
+		r.redactFields(nested)
+		return nested, false
+	}
+	return value, false
+}
+
+// redactedError is an error whose message, the messages of the errors it wraps
+// and its stack trace were redacted, see JsonLogHook.SetErrorDetails.
+type redactedError struct {
+	message string
+	chain   []string
+	stack   string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+// redactError returns err, or a redactedError when its message, the messages
+// of the errors it wraps or its stack trace are sensitive.
+func (r *redactor) redactError(err error) (error, bool) {
+	chain, stack := errorDetails(err)
+	retVal := &redactedError{chain: make([]string, len(chain))}
+	sensitive := false
+	for i, message := range chain {
+		redacted, found := r.redactString(message)
+		retVal.chain[i] = redacted
+		sensitive = sensitive || found
+	}
+	retVal.message = retVal.chain[0]
+	if redacted, found := r.redactString(stack); found {
+		retVal.stack = redacted
+		sensitive = true
+	} else {
+		retVal.stack = stack
+	}
+	if !sensitive {
+		return err, false
+	}
+	return retVal, true
+}
+
+// redactString replaces the sensitive values found in value, and reports
+// whether there were any.
+func (r *redactor) redactString(value string) (string, bool) {
+	sensitive := false
+	for _, detector := range r.detectors {
+		value = detector.pattern.ReplaceAllStringFunc(value, func(match string) string {
+			if detector.valid != nil && !detector.valid(match) {
+				return match
+			}
+			sensitive = true
+			if r.mode == RedactDrop {
+				return ""
+			}
+			return r.replacement(match)
+		})
+	}
+	return value, sensitive
+}
+
+func (r *redactor) sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range r.keys {
+		if matchObjPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) replacement(value string) string {
+	if r.mode != RedactHash {
+		return redactedMask
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:32]
+}
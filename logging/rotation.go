@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// RotationInterval rotates a log file at the start of every period.
+type RotationInterval string
+
+const (
+	// RotateBySizeOnly rotates a log file only when it reaches its maximum size.
+	RotateBySizeOnly RotationInterval = ""
+	// RotateHourly rotates a log file at the start of every hour.
+	RotateHourly RotationInterval = "hourly"
+	// RotateDaily rotates a log file at midnight.
+	RotateDaily RotationInterval = "daily"
+)
+
+// RotationPolicy decides when a log file is rotated and how long its backups
+// are kept. A file is always rotated once it reaches MaxSizeMB; Interval and
+// OnStart rotate it earlier. Zero limits pick the defaults: 1000 MB, 1 backup
+// and 30 days.
+type RotationPolicy struct {
+	MaxSizeMB  int `json:"max_size_mb" yaml:"max_size_mb" toml:"max_size_mb" env:"ROTATION_MAX_SIZE_MB"`
+	MaxBackups int `json:"max_backups" yaml:"max_backups" toml:"max_backups" env:"ROTATION_MAX_BACKUPS"`
+	MaxAgeDays int `json:"max_age_days" yaml:"max_age_days" toml:"max_age_days" env:"ROTATION_MAX_AGE_DAYS"`
+	// Interval rotates the file hourly or daily, in addition to by size.
+	Interval RotationInterval `json:"interval" yaml:"interval" toml:"interval" env:"ROTATION_INTERVAL"`
+	// OnStart rotates a non-empty file before its first write, so each run of
+	// the process starts a new file.
+	OnStart bool `json:"on_start" yaml:"on_start" toml:"on_start" env:"ROTATION_ON_START"`
+	// LocalTime uses the local time for the periods of Interval and the names
+	// of the backups, instead of UTC.
+	LocalTime bool `json:"local_time" yaml:"local_time" toml:"local_time" env:"ROTATION_LOCAL_TIME"`
+	// DisableCompression keeps the backups uncompressed instead of gzipped.
+	DisableCompression bool `json:"disable_compression" yaml:"disable_compression" toml:"disable_compression" env:"ROTATION_DISABLE_COMPRESSION"`
+}
+
+func (policy RotationPolicy) validate(field string, configErr *ConfigError) {
+	limits := []struct {
+		name  string
+		value int
+	}{
+		{"MaxSizeMB", policy.MaxSizeMB},
+		{"MaxBackups", policy.MaxBackups},
+		{"MaxAgeDays", policy.MaxAgeDays},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			configErr.add(field+"."+limit.name, fmt.Errorf("%d is negative", limit.value))
+		}
+	}
+
+	switch policy.Interval {
+	case RotateBySizeOnly, RotateHourly, RotateDaily:
+	default:
+		configErr.add(field+".Interval", fmt.Errorf("unknown rotation interval %q", policy.Interval))
+	}
+}
+
+// withDefaults returns the policy with its zero limits replaced by the
+// defaults.
+func (policy RotationPolicy) withDefaults() RotationPolicy {
+	if policy.MaxSizeMB == 0 {
+		policy.MaxSizeMB = defaultMaxSizeMB
+	}
+	if policy.MaxBackups == 0 {
+		policy.MaxBackups = defaultMaxBackups
+	}
+	if policy.MaxAgeDays == 0 {
+		policy.MaxAgeDays = defaultMaxAgeDays
+	}
+	return policy
+}
+
+// periodStart returns the start of the Interval period containing t, or the
+// zero time without an Interval.
+func (policy RotationPolicy) periodStart(t time.Time) time.Time {
+	location := time.UTC
+	if policy.LocalTime {
+		location = time.Local
+	}
+	t = t.In(location)
+
+	switch policy.Interval {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, location)
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	}
+	return time.Time{}
+}
+
+// rotatingFile is a lumberjack log file that is also rotated by its
+// RotationPolicy's Interval and OnStart. Its writes are serialized by the hook
+// owning it.
+type rotatingFile struct {
+	*lumberjack.Logger
+	policy  RotationPolicy
+	now     func() time.Time
+	started bool
+	period  time.Time
+}
+
+func newRotatingFile(fileName string, policy RotationPolicy) *rotatingFile {
+	policy = policy.withDefaults()
+	return &rotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   fileName,
+			MaxSize:    policy.MaxSizeMB,
+			MaxBackups: policy.MaxBackups,
+			MaxAge:     policy.MaxAgeDays,
+			LocalTime:  policy.LocalTime,
+			Compress:   !policy.DisableCompression,
+		},
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if err := f.rotateIfDue(); err != nil {
+		return 0, err
+	}
+	return f.Logger.Write(p)
+}
+
+// rotateIfDue rotates the file before the first write when OnStart is set or
+// when it was last written in a previous period, and later whenever a new
+// period starts.
+func (f *rotatingFile) rotateIfDue() error {
+	period := f.policy.periodStart(f.now())
+	if f.started {
+		if !period.After(f.period) {
+			return nil
+		}
+		f.period = period
+		return f.Rotate()
+	}
+
+	f.started = true
+	f.period = period
+	info, err := os.Stat(f.Filename)
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	if f.policy.OnStart || f.policy.periodStart(info.ModTime()).Before(period) {
+		return f.Rotate()
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RotatingFileShouldRotateWhenDailyPeriodChanges(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "app.log")
+	file := newRotatingFile(fileName, RotationPolicy{Interval: RotateDaily, MaxBackups: 5, DisableCompression: true})
+	defer file.Close()
+	now := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+	file.now = func() time.Time { return now }
+
+	_, err := file.Write([]byte("day 1\n"))
+	assert.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	_, err = file.Write([]byte("day 1 again\n"))
+	assert.NoError(t, err)
+	assert.Len(t, backups(t, fileName), 0)
+
+	now = now.Add(time.Hour)
+	_, err = file.Write([]byte("day 2\n"))
+	assert.NoError(t, err)
+
+	assert.Len(t, backups(t, fileName), 1)
+	content, _ := os.ReadFile(fileName)
+	assert.Equal(t, "day 2\n", string(content))
+}
+
+func Test_RotatingFileShouldRotateOnStart(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "app.log")
+	assert.NoError(t, os.WriteFile(fileName, []byte("previous run\n"), 0644))
+
+	hook := NewRotatingJsonLogFileHook(fileName, LoggerFields{}, logrus.InfoLevel, RotationPolicy{OnStart: true, DisableCompression: true})
+	assert.NoError(t, fireMessage(hook, logrus.InfoLevel, "Test"))
+	assert.NoError(t, hook.Close())
+
+	assert.Len(t, backups(t, fileName), 1)
+	entries := loadLogFile(fileName)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "Test", entries[0]["message"])
+}
+
+func Test_RotatingFileShouldRotateFileFromPreviousPeriodOnStart(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "app.log")
+	assert.NoError(t, os.WriteFile(fileName, []byte("yesterday\n"), 0644))
+	yesterday := time.Now().Add(-24 * time.Hour)
+	assert.NoError(t, os.Chtimes(fileName, yesterday, yesterday))
+
+	file := newRotatingFile(fileName, RotationPolicy{Interval: RotateDaily, DisableCompression: true})
+	_, err := file.Write([]byte("today\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	assert.Len(t, backups(t, fileName), 1)
+}
+
+func Test_RotatingFileShouldAppendWithoutPolicy(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "app.log")
+	assert.NoError(t, os.WriteFile(fileName, []byte("previous run\n"), 0644))
+
+	file := newRotatingFile(fileName, RotationPolicy{})
+	_, err := file.Write([]byte("this run\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	assert.Len(t, backups(t, fileName), 0)
+	content, _ := os.ReadFile(fileName)
+	assert.Equal(t, "previous run\nthis run\n", string(content))
+}
+
+func Test_RotationPolicyPeriodStartShouldUseConfiguredTimeZone(t *testing.T) {
+	moment := time.Date(2020, 1, 1, 23, 30, 0, 0, time.FixedZone("east", 3*60*60))
+
+	utc := RotationPolicy{Interval: RotateDaily}.periodStart(moment)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), utc)
+
+	hourly := RotationPolicy{Interval: RotateHourly}.periodStart(moment)
+	assert.Equal(t, time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC), hourly)
+
+	local := RotationPolicy{Interval: RotateDaily, LocalTime: true}.periodStart(moment)
+	assert.Equal(t, time.Local, local.Location())
+}
+
+func Test_ConfigShouldValidateRotation(t *testing.T) {
+	config := Config{Level: "info", Rotation: RotationPolicy{Interval: "weekly", MaxAgeDays: -1}}
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(config.Validate(), &configErr))
+	assert.Len(t, configErr.Problems, 2)
+	assert.Equal(t, "Rotation.MaxAgeDays", configErr.Problems[0].Field)
+	assert.Equal(t, "Rotation.Interval", configErr.Problems[1].Field)
+}
+
+func Test_ConfigRotationPolicyShouldKeepTheLegacyLimits(t *testing.T) {
+	assert.Equal(t, RotationPolicy{MaxSizeMB: 1000, MaxBackups: 1, MaxAgeDays: 30}, Config{}.rotationPolicy())
+	assert.Equal(t, RotationPolicy{MaxSizeMB: 10, MaxBackups: 1, MaxAgeDays: 7}, Config{MaxSizeMB: 10}.rotationPolicy())
+	assert.Equal(t, RotationPolicy{MaxSizeMB: 20, MaxBackups: 3, MaxAgeDays: 7, Interval: RotateHourly},
+		Config{MaxSizeMB: 10, MaxBackups: 3, Rotation: RotationPolicy{MaxSizeMB: 20, Interval: RotateHourly}}.rotationPolicy())
+}
+
+// backups returns the rotated copies of fileName.
+func backups(t *testing.T, fileName string) []string {
+	ext := filepath.Ext(fileName)
+	matches, err := filepath.Glob(fileName[:len(fileName)-len(ext)] + "-*" + ext)
+	assert.NoError(t, err)
+	return matches
+}
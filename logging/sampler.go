@@ -0,0 +1,300 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldNameSampledOut holds the number of entries dropped by sampling in the
+// entry reporting them.
+const FieldNameSampledOut = "sampled_out"
+
+const defaultSamplingInterval = time.Second
+
+// SamplingRule lets the First entries with the same key through in every
+// interval, and then one in Thereafter of them. Zero Thereafter drops all the
+// others; zero First doesn't sample at all.
+type SamplingRule struct {
+	First      int `json:"first" yaml:"first" toml:"first" env:"FIRST"`
+	Thereafter int `json:"thereafter" yaml:"thereafter" toml:"thereafter" env:"THEREAFTER"`
+}
+
+// SamplingConfig limits how many entries with the same level, obj and message
+// are logged per Interval. Numbers in the messages are ignored, so
+// "processed item 17" and "processed item 18" are sampled together. The dropped
+// entries of an interval are reported by a single entry once it ends, with the
+// count under FieldNameSampledOut.
+//
+// The rule of an entry is the one of its obj in Objs, matched like ObjLevels,
+// else the one of its level in Levels, else the SamplingRule of the config:
+//
+//	{"interval": "1s", "first": 100, "thereafter": 100, "objs": {"worker": {"first": 10}}, "levels": {"warning": {"first": 0}}}
+//
+// Error entries are only sampled with SampleErrors; fatal and panic entries
+// never are.
+type SamplingConfig struct {
+	// Interval defaults to 1s.
+	Interval     string `json:"interval" yaml:"interval" toml:"interval" env:"INTERVAL"`
+	SamplingRule `yaml:",inline"`
+	Levels       map[string]SamplingRule `json:"levels" yaml:"levels" toml:"levels"`
+	Objs         map[string]SamplingRule `json:"objs" yaml:"objs" toml:"objs"`
+	SampleErrors bool                    `json:"sample_errors" yaml:"sample_errors" toml:"sample_errors" env:"SAMPLE_ERRORS"`
+}
+
+func (config SamplingConfig) validate(field string, configErr *ConfigError) {
+	if config.Interval != "" {
+		if interval, err := time.ParseDuration(config.Interval); err != nil {
+			configErr.add(field+".Interval", err)
+		} else if interval <= 0 {
+			configErr.add(field+".Interval", fmt.Errorf("%s is not positive", config.Interval))
+		}
+	}
+
+	config.SamplingRule.validate(field, configErr)
+	for _, level := range sortedRuleKeys(config.Levels) {
+		if _, err := logrus.ParseLevel(level); err != nil {
+			configErr.add(fmt.Sprintf("%s.Levels[%s]", field, level), err)
+		}
+		config.Levels[level].validate(fmt.Sprintf("%s.Levels[%s]", field, level), configErr)
+	}
+	for _, obj := range sortedRuleKeys(config.Objs) {
+		config.Objs[obj].validate(fmt.Sprintf("%s.Objs[%s]", field, obj), configErr)
+	}
+}
+
+func (rule SamplingRule) validate(field string, configErr *ConfigError) {
+	if rule.First < 0 {
+		configErr.add(field+".First", fmt.Errorf("%d is negative", rule.First))
+	}
+	if rule.Thereafter < 0 {
+		configErr.add(field+".Thereafter", fmt.Errorf("%d is negative", rule.Thereafter))
+	}
+}
+
+func (config SamplingConfig) copy() SamplingConfig {
+	config.Levels = copyRules(config.Levels)
+	config.Objs = copyRules(config.Objs)
+	return config
+}
+
+func copyRules(rules map[string]SamplingRule) map[string]SamplingRule {
+	if rules == nil {
+		return nil
+	}
+	retVal := make(map[string]SamplingRule, len(rules))
+	for key, rule := range rules {
+		retVal[key] = rule
+	}
+	return retVal
+}
+
+func sortedRuleKeys(rules map[string]SamplingRule) []string {
+	keys := make([]string, 0, len(rules))
+	for key := range rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sampler applies a SamplingConfig to entries. The entries reporting the
+// dropped ones are logged through logger once their interval ends.
+type sampler struct {
+	logger       *logrus.Logger
+	interval     time.Duration
+	rule         SamplingRule
+	levels       map[logrus.Level]SamplingRule
+	exact        map[string]SamplingRule
+	patterns     []string
+	patternRules map[string]SamplingRule
+	sampleErrors bool
+	now          func() time.Time
+
+	lock      sync.Mutex
+	windows   map[sampleKey]*sampleWindow
+	lastSweep time.Time
+}
+
+type sampleKey struct {
+	level   logrus.Level
+	obj     string
+	message string
+}
+
+type sampleWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+	message string
+	timer   *time.Timer
+}
+
+// newSampler returns the sampler of config, or nil when config samples
+// nothing.
+func newSampler(config SamplingConfig, logger *logrus.Logger) *sampler {
+	if config.First == 0 && len(config.Levels) == 0 && len(config.Objs) == 0 {
+		return nil
+	}
+
+	retVal := &sampler{
+		logger:       logger,
+		interval:     defaultSamplingInterval,
+		rule:         config.SamplingRule,
+		levels:       make(map[logrus.Level]SamplingRule, len(config.Levels)),
+		exact:        make(map[string]SamplingRule),
+		patternRules: make(map[string]SamplingRule),
+		sampleErrors: config.SampleErrors,
+		now:          time.Now,
+		windows:      make(map[sampleKey]*sampleWindow),
+	}
+	if config.Interval != "" {
+		retVal.interval, _ = time.ParseDuration(config.Interval)
+	}
+	for levelStr, rule := range config.Levels {
+		level, _ := logrus.ParseLevel(levelStr)
+		retVal.levels[level] = rule
+	}
+	for obj, rule := range config.Objs {
+		if strings.Contains(obj, "*") {
+			retVal.patterns = append(retVal.patterns, obj)
+			retVal.patternRules[obj] = rule
+		} else {
+			retVal.exact[obj] = rule
+		}
+	}
+	sort.Slice(retVal.patterns, func(i, j int) bool {
+		return moreSpecificPattern(retVal.patterns[i], retVal.patterns[j])
+	})
+	return retVal
+}
+
+// ruleFor returns the rule of the entries with the given level and obj.
+func (s *sampler) ruleFor(level logrus.Level, obj string) SamplingRule {
+	if rule, found := s.exact[obj]; found {
+		return rule
+	}
+	for _, pattern := range s.patterns {
+		if matchObjPattern(pattern, obj) {
+			return s.patternRules[pattern]
+		}
+	}
+	if rule, found := s.levels[level]; found {
+		return rule
+	}
+	return s.rule
+}
+
+// allows counts the entry in its interval and reports whether it is logged.
+func (s *sampler) allows(entry *logrus.Entry) bool {
+	if entry.Level <= logrus.FatalLevel || (entry.Level == logrus.ErrorLevel && !s.sampleErrors) {
+		return true
+	}
+	obj, _ := entry.Data[FieldNameObj].(string)
+	rule := s.ruleFor(entry.Level, obj)
+	if rule.First == 0 {
+		return true
+	}
+
+	key := sampleKey{level: entry.Level, obj: obj, message: messageTemplate(entry.Message)}
+	now := s.now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	window := s.windows[key]
+	if window == nil || now.Sub(window.start) >= s.interval {
+		s.sweep(now)
+		window = &sampleWindow{start: now}
+		s.windows[key] = window
+	}
+	window.count++
+	if window.count <= rule.First {
+		return true
+	}
+	if rule.Thereafter > 0 && (window.count-rule.First)%rule.Thereafter == 0 {
+		return true
+	}
+
+	window.dropped++
+	window.message = entry.Message
+	if window.timer == nil {
+		window.timer = time.AfterFunc(window.start.Add(s.interval).Sub(now), func() {
+			s.report(key, window)
+		})
+	}
+	return false
+}
+
+// sweep forgets the ended windows that dropped nothing, at most once per
+// interval. It must be called with the lock held.
+func (s *sampler) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.interval {
+		return
+	}
+	s.lastSweep = now
+	for key, window := range s.windows {
+		if window.timer == nil && now.Sub(window.start) >= s.interval {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// report logs the entry reporting the entries dropped in window.
+func (s *sampler) report(key sampleKey, window *sampleWindow) {
+	s.lock.Lock()
+	dropped, message := window.dropped, window.message
+	window.dropped = 0
+	if s.windows[key] == window {
+		delete(s.windows, key)
+	}
+	s.lock.Unlock()
+
+	if dropped == 0 {
+		return
+	}
+	summary := logrus.NewEntry(s.logger).WithContext(bypassStages(nil)).WithFields(logrus.Fields{
+		FieldNameObj:        key.obj,
+		FieldNameSampledOut: dropped,
+	})
+	summary.Log(key.level, fmt.Sprintf("%d entries sampled out: %s", dropped, message))
+}
+
+// flush reports the dropped entries of the windows that haven't ended yet.
+func (s *sampler) flush() {
+	s.lock.Lock()
+	pending := make(map[sampleKey]*sampleWindow)
+	for key, window := range s.windows {
+		if window.timer != nil && window.timer.Stop() {
+			window.timer = nil
+			pending[key] = window
+		}
+	}
+	s.lock.Unlock()
+
+	for key, window := range pending {
+		s.report(key, window)
+	}
+}
+
+// messageTemplate returns message with its numbers replaced by '#'.
+func messageTemplate(message string) string {
+	var builder strings.Builder
+	inNumber := false
+	for _, r := range message {
+		if r >= '0' && r <= '9' {
+			if !inNumber {
+				builder.WriteByte('#')
+			}
+			inNumber = true
+			continue
+		}
+		inNumber = false
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
@@ -0,0 +1,192 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SamplingShouldLetFirstThenOneInThereafterThrough(t *testing.T) {
+	logger, console := newSamplingLogger(t, SamplingConfig{
+		Interval:     "1h",
+		SamplingRule: SamplingRule{First: 2, Thereafter: 3},
+	})
+
+	for i := 1; i <= 10; i++ {
+		logger.GetLog("worker").Debugf("processed item %d", i)
+	}
+	assert.Equal(t, []string{"processed item 1", "processed item 2", "processed item 5", "processed item 8"}, console.messages())
+
+	assert.NoError(t, logger.Flush())
+	assert.Equal(t, "6 entries sampled out: processed item 10", console.last()["msg"])
+	assert.Equal(t, "6", console.last()[FieldNameSampledOut])
+	assert.Equal(t, "debug", console.last()["level"])
+}
+
+func Test_SamplingShouldReportDroppedEntriesWhenIntervalEnds(t *testing.T) {
+	logger, console := newSamplingLogger(t, SamplingConfig{
+		Interval:     "50ms",
+		SamplingRule: SamplingRule{First: 1},
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.GetLog("worker").Info("tick")
+	}
+
+	assert.Eventually(t, func() bool {
+		return console.last()["msg"] == "2 entries sampled out: tick"
+	}, time.Second, 10*time.Millisecond)
+	logger.GetLog("worker").Info("tick")
+	assert.Equal(t, "tick", console.last()["msg"])
+}
+
+func Test_SamplingShouldNotSampleErrorsByDefault(t *testing.T) {
+	logger, console := newSamplingLogger(t, SamplingConfig{Interval: "1h", SamplingRule: SamplingRule{First: 1}})
+
+	for i := 0; i < 3; i++ {
+		logger.GetLog("worker").Error("failed")
+	}
+	assert.Len(t, console.messages(), 3)
+
+	config := logger.currentConfig()
+	config.Sampling.SampleErrors = true
+	assert.NoError(t, logger.Reload(config))
+	for i := 0; i < 3; i++ {
+		logger.GetLog("worker").Error("failed again")
+	}
+	assert.Len(t, console.messages(), 5)
+}
+
+func Test_SamplerRuleShouldPreferObjThenLevel(t *testing.T) {
+	s := newSampler(SamplingConfig{
+		SamplingRule: SamplingRule{First: 100},
+		Levels:       map[string]SamplingRule{"debug": {First: 10}},
+		Objs:         map[string]SamplingRule{"db": {First: 1}, "db.*": {First: 2}, "*": {First: 3}},
+	}, logrus.New())
+
+	assert.Equal(t, SamplingRule{First: 1}, s.ruleFor(logrus.DebugLevel, "db"))
+	assert.Equal(t, SamplingRule{First: 2}, s.ruleFor(logrus.DebugLevel, "db.query"))
+	assert.Equal(t, SamplingRule{First: 3}, s.ruleFor(logrus.DebugLevel, "http"))
+
+	s = newSampler(SamplingConfig{
+		SamplingRule: SamplingRule{First: 100},
+		Levels:       map[string]SamplingRule{"debug": {First: 10}},
+	}, logrus.New())
+	assert.Equal(t, SamplingRule{First: 10}, s.ruleFor(logrus.DebugLevel, "http"))
+	assert.Equal(t, SamplingRule{First: 100}, s.ruleFor(logrus.InfoLevel, "http"))
+}
+
+func Test_SamplingShouldBeValidated(t *testing.T) {
+	config := Config{Level: "info", Sampling: SamplingConfig{
+		Interval: "often",
+		Levels:   map[string]SamplingRule{"loud": {First: -1}},
+	}}
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(config.Validate(), &configErr))
+	fields := make([]string, len(configErr.Problems))
+	for i, problem := range configErr.Problems {
+		fields[i] = problem.Field
+	}
+	assert.Equal(t, []string{"Sampling.Interval", "Sampling.Levels[loud]", "Sampling.Levels[loud].First"}, fields)
+}
+
+func Test_SampledOutEntriesShouldNotBeWrittenToTheConsole(t *testing.T) {
+	logger, console := newSamplingLogger(t, SamplingConfig{
+		Interval:     "1h",
+		SamplingRule: SamplingRule{First: 1},
+	})
+
+	for i := 0; i < 100; i++ {
+		logger.GetLog("worker").Info("tick")
+	}
+	logger.GetLog("worker").Trace("filtered out")
+
+	assert.Equal(t, []string{"tick"}, console.messages())
+	assert.Zero(t, console.emptyWrites)
+}
+
+func Test_MessageTemplate(t *testing.T) {
+	assert.Equal(t, "processed item # of #", messageTemplate("processed item 17 of 200"))
+	assert.Equal(t, "no numbers", messageTemplate("no numbers"))
+}
+
+func newSamplingLogger(t *testing.T, sampling SamplingConfig) (*Logger, *consoleOutput) {
+	return newJsonConsoleLogger(t, Config{Level: "debug", Sampling: sampling})
+}
+
+// newJsonConsoleLogger creates a Logger whose console output is JSON collected
+// by a consoleOutput.
+func newJsonConsoleLogger(t *testing.T, config Config) (*Logger, *consoleOutput) {
+	logger, err := New(config)
+	assert.NoError(t, err)
+	t.Cleanup(func() { logger.Close() })
+
+	console := &consoleOutput{}
+	logger.setOutput(console)
+	logger.logger.SetFormatter(&filteringFormatter{
+		Formatter:  &logrus.JSONFormatter{},
+		dispatcher: logger.dispatcher,
+	})
+	return logger, console
+}
+
+// consoleOutput collects the JSON console output of a Logger.
+type consoleOutput struct {
+	lock        sync.Mutex
+	entries     []map[string]string
+	emptyWrites int
+}
+
+func (c *consoleOutput) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(p) == 0 {
+		c.emptyWrites++
+		return 0, nil
+	}
+
+	for _, line := range bytes.Split(bytes.TrimSpace(p), []byte("\n")) {
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return 0, err
+		}
+		entry := make(map[string]string, len(fields))
+		for key, value := range fields {
+			entry[key] = fmt.Sprint(value)
+		}
+		c.entries = append(c.entries, entry)
+	}
+	return len(p), nil
+}
+
+func (c *consoleOutput) messages() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	retVal := make([]string, 0, len(c.entries))
+	for _, entry := range c.entries {
+		if entry[FieldNameSampledOut] == "" && entry[FieldNameRepeatCount] == "" {
+			retVal = append(retVal, entry["msg"])
+		}
+	}
+	return retVal
+}
+
+func (c *consoleOutput) last() map[string]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.entries) == 0 {
+		return nil
+	}
+	return c.entries[len(c.entries)-1]
+}
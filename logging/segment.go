@@ -1,13 +1,23 @@
 package logging
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
-	"reflect"
 	"time"
 )
 
 type Segment interface {
 	Parent() Trace
+	// ParentSegment returns the segment this one was started from by StartChild
+	// or NewChild, or nil.
+	ParentSegment() Segment
+	Id() string
+	StartChild(segmentName string, args ...interface{}) Segment
+	NewChild() SegmentBuilder
+	// TraceParent returns the W3C Trace Context to send with the calls made
+	// by the segment, unless the trace doesn't use W3C ids. Its tracestate is
+	// the one of the trace.
+	TraceParent() (TraceParent, bool)
 	End(args ...interface{})
 	EndWithErrorIf(err error, elseArgs ...interface{})
 	EndWithWarningIf(err error, elseArgs ...interface{})
@@ -19,11 +29,13 @@ type Segment interface {
 }
 
 type segment struct {
-	logger          *logrus.Entry
-	parent          *trace
-	name            string
-	startTime       time.Time
-	markerLogMethod string
+	logger        *logrus.Entry
+	parent        *trace
+	parentSegment Segment
+	id            string
+	name          string
+	startTime     time.Time
+	markerLevel   logrus.Level
 }
 
 type errorMarkersOnlySegment struct {
@@ -34,17 +46,51 @@ func (s *segment) Parent() Trace {
 	return s.parent
 }
 
+func (s *segment) ParentSegment() Segment {
+	return s.parentSegment
+}
+
+func (s *segment) Id() string {
+	return s.id
+}
+
+func (s *segment) StartChild(segmentName string, args ...interface{}) Segment {
+	return s.NewChild().Start(segmentName, args...)
+}
+
+func (s *segment) NewChild() SegmentBuilder {
+	return s.newChild(s)
+}
+
+// newChild returns a builder of the children of parent, which is s or wraps
+// it. They inherit the fields of s.
+func (s *segment) newChild(parent Segment) SegmentBuilder {
+	return &segmentBuilder{
+		parent:        s.parent,
+		parentSegment: parent,
+		logger:        s.logger,
+	}
+}
+
+func (s *segment) TraceParent() (TraceParent, bool) {
+	if !s.parent.w3c {
+		return TraceParent{}, false
+	}
+	return TraceParent{TraceId: s.parent.id, ParentId: s.id, Sampled: s.parent.sampled}, true
+}
+
 func (s *segment) End(args ...interface{}) {
-	logMarkerEntry(s.endEntry(), s.markerLogMethod, args...)
+	logMarkerEntry(s.endEntry(), s.markerLevel, args...)
 }
 
 func (s *segment) EndWithErrorIf(err error, elseArgs ...interface{}) {
 	entry := s.endEntry()
 
 	if err != nil {
-		entry.Error(err)
+		s.parent.MarkFailed()
+		entry.WithContext(withSegmentError(entry.Context, err)).Error(err)
 	} else {
-		logMarkerEntry(entry, s.markerLogMethod, elseArgs...)
+		logMarkerEntry(entry, s.markerLevel, elseArgs...)
 	}
 }
 
@@ -52,9 +98,9 @@ func (s *segment) EndWithWarningIf(err error, elseArgs ...interface{}) {
 	entry := s.endEntry()
 
 	if err != nil {
-		entry.Warn(err)
+		entry.WithContext(withSegmentError(entry.Context, err)).Warn(err)
 	} else {
-		logMarkerEntry(entry, s.markerLogMethod, elseArgs...)
+		logMarkerEntry(entry, s.markerLevel, elseArgs...)
 
 	}
 }
@@ -67,7 +113,7 @@ func (s *segment) Mark(marker string, args ...interface{}) Segment {
 			FieldNameMarker:  marker,
 		})
 
-	logMarkerEntry(entry, s.markerLogMethod, args...)
+	logMarkerEntry(entry, s.markerLevel, args...)
 
 	return s
 }
@@ -85,7 +131,7 @@ func (s *segment) AddField(name string, value interface{}) Segment {
 func (s *segment) start(args ...interface{}) {
 	entry := s.logger.WithField(FieldNameMarker, MarkerStart)
 
-	logMarkerEntry(entry, s.markerLogMethod, args...)
+	logMarkerEntry(entry, s.markerLevel, args...)
 }
 
 func (s *segment) endEntry() *logrus.Entry {
@@ -102,6 +148,26 @@ func (s *errorMarkersOnlySegment) Parent() Trace {
 	return s.delegate.Parent()
 }
 
+func (s *errorMarkersOnlySegment) ParentSegment() Segment {
+	return s.delegate.ParentSegment()
+}
+
+func (s *errorMarkersOnlySegment) Id() string {
+	return s.delegate.Id()
+}
+
+func (s *errorMarkersOnlySegment) StartChild(segmentName string, args ...interface{}) Segment {
+	return s.NewChild().Start(segmentName, args...)
+}
+
+func (s *errorMarkersOnlySegment) NewChild() SegmentBuilder {
+	return s.delegate.(*segment).newChild(s)
+}
+
+func (s *errorMarkersOnlySegment) TraceParent() (TraceParent, bool) {
+	return s.delegate.TraceParent()
+}
+
 func (s *errorMarkersOnlySegment) End(args ...interface{}) {}
 
 func (s *errorMarkersOnlySegment) EndWithErrorIf(err error, args ...interface{}) {
@@ -130,10 +196,23 @@ func elapsedSec(startTime time.Time) float32 {
 	return float32(time.Since(startTime).Seconds())
 }
 
-func logMarkerEntry(entry *logrus.Entry, markerLogMethod string, args ...interface{}) {
-	parameters := make([]reflect.Value, len(args))
-	for i := range args {
-		parameters[i] = reflect.ValueOf(args[i])
+type segmentErrorKey struct{}
+
+// withSegmentError returns ctx carrying the error a segment ended with. Its
+// message is the one of the entry, and only the errors file adds its chain and
+// stack trace, see JsonLogHook.SetErrorDetails.
+func withSegmentError(ctx context.Context, err error) context.Context {
+	return context.WithValue(contextOrBackground(ctx), segmentErrorKey{}, err)
+}
+
+func segmentError(ctx context.Context) error {
+	if ctx == nil {
+		return nil
 	}
-	reflect.ValueOf(entry).MethodByName(markerLogMethod).Call(parameters)
+	err, _ := ctx.Value(segmentErrorKey{}).(error)
+	return err
+}
+
+func logMarkerEntry(entry *logrus.Entry, markerLevel logrus.Level, args ...interface{}) {
+	entry.Log(markerLevel, args...)
 }
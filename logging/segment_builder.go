@@ -15,9 +15,10 @@ type SegmentBuilder interface {
 
 type segmentBuilder struct {
 	parent           *trace
+	parentSegment    Segment
 	errorMarkersOnly bool
 	logger           *logrus.Entry
-	markerLogMethod  string
+	debugMarkers     bool
 }
 
 func (builder *segmentBuilder) WithField(name string, value interface{}) SegmentBuilder {
@@ -32,7 +33,7 @@ func (builder *segmentBuilder) WithFields(fields map[string]interface{}) Segment
 }
 
 func (builder *segmentBuilder) WithDebugMarkers() SegmentBuilder {
-	builder.markerLogMethod = "Debug"
+	builder.debugMarkers = true
 
 	return builder
 }
@@ -43,24 +44,33 @@ func (builder *segmentBuilder) WithErrorMarkersOnly() SegmentBuilder {
 }
 func (builder *segmentBuilder) Start(segmentName string, args ...interface{}) Segment {
 	start := time.Now()
-	baseEntry := builder.logger.
-		WithFields(
-			logrus.Fields{
-				FieldNameTraceId: builder.parent.id,
-				FieldNameAction:  builder.parent.name,
-				FieldNameSegment: segmentName,
-			})
+	id := builder.parent.newSegmentId()
+	fields := logrus.Fields{
+		FieldNameTraceId:   builder.parent.id,
+		FieldNameAction:    builder.parent.name,
+		FieldNameSegment:   segmentName,
+		FieldNameSegmentId: id,
+	}
+	if builder.parentSegment != nil {
+		fields[FieldNameParentSegmentId] = builder.parentSegment.Id()
+	} else if builder.parent.caller != nil && builder.parent.caller.ParentId != "" {
+		fields[FieldNameParentSegmentId] = builder.parent.caller.ParentId
+	}
+	baseEntry := builder.logger.WithFields(fields)
 
-	if builder.markerLogMethod == "" {
-		builder.markerLogMethod = "Info"
+	markerLevel := logrus.InfoLevel
+	if builder.debugMarkers {
+		markerLevel = logrus.DebugLevel
 	}
 
 	var s Segment = &segment{
-		logger:          baseEntry,
-		parent:          builder.parent,
-		name:            segmentName,
-		startTime:       start,
-		markerLogMethod: builder.markerLogMethod,
+		logger:        baseEntry,
+		parent:        builder.parent,
+		parentSegment: builder.parentSegment,
+		id:            id,
+		name:          segmentName,
+		startTime:     start,
+		markerLevel:   markerLevel,
 	}
 
 	if builder.errorMarkersOnly {
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sink is a logrus hook that owns an output which must be flushed and closed on
+// shutdown, like JsonLogHook.
+type Sink interface {
+	logrus.Hook
+	Flush() error
+	Close() error
+}
+
+// levelSink is a Sink whose minimum level can be changed at runtime. A Logger
+// manages its sinks through it.
+type levelSink interface {
+	Sink
+	SetLevel(level logrus.Level)
+	Level() logrus.Level
+}
+
+// drainer is anything Shutdown drains: a Logger or a registered Sink.
+type drainer interface {
+	Close() error
+}
+
+var registry = struct {
+	lock     sync.Mutex
+	drainers map[drainer]struct{}
+}{
+	drainers: make(map[drainer]struct{}),
+}
+
+// RegisterSink registers a sink created outside of a Logger, e.g. a JsonLogHook
+// added to another logrus logger, so that Shutdown drains it too.
+func RegisterSink(sink Sink) {
+	register(sink)
+}
+
+// Shutdown flushes and closes every registered sink: the sinks of every
+// configured Logger, including the default one, and the sinks passed to
+// RegisterSink. Sinks are drained concurrently; when ctx is done first,
+// Shutdown returns ctx.Err() without waiting for the rest. Loggers keep writing
+// to the console after Shutdown.
+func Shutdown(ctx context.Context) error {
+	registry.lock.Lock()
+	drainers := make([]drainer, 0, len(registry.drainers))
+	for d := range registry.drainers {
+		drainers = append(drainers, d)
+	}
+	registry.drainers = make(map[drainer]struct{})
+	registry.lock.Unlock()
+
+	errs := make(chan error, len(drainers))
+	for _, d := range drainers {
+		go func(d drainer) {
+			errs <- d.Close()
+		}(d)
+	}
+
+	var retVal error
+	for range drainers {
+		select {
+		case err := <-errs:
+			if err != nil && retVal == nil {
+				retVal = err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return retVal
+}
+
+func register(d drainer) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	registry.drainers[d] = struct{}{}
+}
+
+func unregister(d drainer) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	delete(registry.drainers, d)
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ShutdownShouldDrainLoggersAndRegisteredSinks(t *testing.T) {
+	folder := t.TempDir()
+	logger, err := New(Config{Level: "info", AppName: appName, LogsFolder: folder, LogToJsonFile: true})
+	assert.NoError(t, err)
+	buffer := new(bytes.Buffer)
+	hook := NewJsonLogHook(logrus.InfoLevel, LoggerFields{}, bufio.NewWriter(buffer))
+	RegisterSink(hook)
+	fireInfo(hook)
+	assert.Empty(t, buffer.String())
+
+	assert.NoError(t, Shutdown(context.Background()))
+
+	assert.NotEmpty(t, buffer.String())
+	assert.Equal(t, ErrSinkClosed, fireInfo(hook))
+	assert.Empty(t, logger.runningSinks())
+	assert.Len(t, loadLogFile(path.Join(folder, appName+"_logstash_json.log")), 1)
+}
+
+func Test_ShutdownShouldGiveUpWhenTheContextIsDone(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	defer close(sink.release)
+	RegisterSink(sink)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, Shutdown(ctx))
+}
+
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s *blockingSink) Levels() []logrus.Level         { return logrus.AllLevels }
+func (s *blockingSink) Fire(entry *logrus.Entry) error { return nil }
+func (s *blockingSink) Flush() error                   { return nil }
+func (s *blockingSink) Close() error {
+	<-s.release
+	return nil
+}
+
+func fireInfo(hook logrus.Hook) error {
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+	entry.Message = "Test"
+	return hook.Fire(entry)
+}
@@ -0,0 +1,306 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SinkDestination is where a sink writes its entries.
+type SinkDestination string
+
+const (
+	// DestinationStdout writes to the standard output.
+	DestinationStdout SinkDestination = "stdout"
+	// DestinationStderr writes to the standard error.
+	DestinationStderr SinkDestination = "stderr"
+	// DestinationFile writes to SinkConfig.Path, rotated by Config.Rotation
+	// like the JSON log file.
+	DestinationFile SinkDestination = "file"
+	// DestinationWriter writes to SinkConfig.Writer.
+	DestinationWriter SinkDestination = "writer"
+	// DestinationTCP sends the entries to SinkConfig.Address over TCP, e.g. a
+	// Logstash tcp input with the json_lines codec or a syslog daemon, with
+	// SinkConfig.TLS when enabled.
+	DestinationTCP SinkDestination = "tcp"
+	// DestinationUDP sends each entry in a datagram to SinkConfig.Address.
+	DestinationUDP SinkDestination = "udp"
+	// DestinationHTTP POSTs batches of JSON entries to SinkConfig.URL, see
+	// HTTPOptions.
+	DestinationHTTP SinkDestination = "http"
+)
+
+// SinkFormat is how a sink formats its entries.
+type SinkFormat string
+
+const (
+	// FormatJson writes the entries with LogJsonFormatter, with the
+	// AdditionalFields and the fields laid out like the JSON log file.
+	FormatJson SinkFormat = "json"
+	// FormatText writes a line per entry: timestamp, level, message and the
+	// fields sorted by key.
+	FormatText SinkFormat = "text"
+	// FormatLogfmt writes the entries as key=value pairs.
+	FormatLogfmt SinkFormat = "logfmt"
+	// FormatConsole writes the entries like the logrus console output,
+	// colored when Config.Colors is set.
+	FormatConsole SinkFormat = "console"
+	// FormatSyslog writes the entries as RFC 5424 syslog messages, see
+	// SyslogFormatter. Over TCP they are octet counted, per RFC 6587.
+	FormatSyslog SinkFormat = "syslog"
+)
+
+// SinkConfig configures one of the Config.Sinks. Each sink has its own
+// destination, format and level, e.g. JSON to a file at debug, the console at
+// info and the errors to stderr:
+//
+//	[{"destination": "file", "path": "/var/log/app.json", "format": "json"},
+//	 {"destination": "stdout", "format": "console", "level": "info"},
+//	 {"destination": "stderr", "format": "text", "level": "error"}]
+//
+// Network destinations send the entries from a background goroutine: they wait
+// in the Spool until sent, and the sink reconnects with the Reconnect backoff
+// while the destination is unreachable:
+//
+//	[{"destination": "tcp", "address": "logstash:5000", "tls": {"enabled": true}},
+//	 {"destination": "udp", "address": "localhost:514", "format": "syslog", "facility": "local0"}]
+type SinkConfig struct {
+	// Name identifies the sink in the admin handler. It defaults to the
+	// destination and path.
+	Name        string          `json:"name" yaml:"name" toml:"name"`
+	Destination SinkDestination `json:"destination" yaml:"destination" toml:"destination"`
+	// Path is the file written by DestinationFile.
+	Path string `json:"path" yaml:"path" toml:"path"`
+	// Writer is written by DestinationWriter. It can only be set from code.
+	Writer io.Writer `json:"-" yaml:"-" toml:"-"`
+	// Address is the host:port of DestinationTCP and DestinationUDP.
+	Address string `json:"address" yaml:"address" toml:"address"`
+	// URL is the endpoint of DestinationHTTP.
+	URL string `json:"url" yaml:"url" toml:"url"`
+	// HTTP configures DestinationHTTP.
+	HTTP HTTPOptions `json:"http" yaml:"http" toml:"http"`
+	// TLS encrypts DestinationTCP, and configures the https URLs of
+	// DestinationHTTP.
+	TLS TLSConfig `json:"tls" yaml:"tls" toml:"tls"`
+	// Reconnect is the backoff of the network destinations.
+	Reconnect BackoffConfig `json:"reconnect" yaml:"reconnect" toml:"reconnect"`
+	// Spool holds the entries of the network destinations until sent.
+	Spool SpoolConfig `json:"spool" yaml:"spool" toml:"spool"`
+	// Facility is the facility of FormatSyslog, e.g. "local0". It defaults to
+	// "user".
+	Facility string `json:"facility" yaml:"facility" toml:"facility"`
+	// EnterpriseId is the private enterprise number of the organization ending
+	// the structured data ids of FormatSyslog, see
+	// SyslogFormatter.SetEnterpriseId.
+	EnterpriseId string `json:"enterprise_id" yaml:"enterprise_id" toml:"enterprise_id"`
+	// Format defaults to FormatJson.
+	Format SinkFormat `json:"format" yaml:"format" toml:"format"`
+	// Level further restricts the entries the sink writes: entries are first
+	// filtered by Config.Level and Config.ObjLevels. Empty writes all of them.
+	Level string `json:"level" yaml:"level" toml:"level"`
+}
+
+func (sink SinkConfig) validate(field string, configErr *ConfigError) {
+	switch sink.Destination {
+	case DestinationStdout, DestinationStderr:
+	case DestinationFile:
+		if sink.Path == "" {
+			configErr.add(field+".Path", errors.New("required by the file destination"))
+		} else if err := validateLogsFolder(path.Dir(sink.Path)); err != nil {
+			configErr.add(field+".Path", err)
+		} else if err := validateLogFile(sink.Path); err != nil {
+			configErr.add(field+".Path", err)
+		}
+	case DestinationWriter:
+		if sink.Writer == nil {
+			configErr.add(field+".Writer", errors.New("required by the writer destination"))
+		}
+	case DestinationTCP, DestinationUDP:
+		if _, _, err := net.SplitHostPort(sink.Address); err != nil {
+			configErr.add(field+".Address", err)
+		}
+		if sink.TLS.Enabled && sink.Destination == DestinationUDP {
+			configErr.add(field+".TLS", errors.New("not supported by the udp destination"))
+		}
+		sink.TLS.validate(field+".TLS", configErr)
+		sink.Reconnect.validate(field+".Reconnect", configErr)
+		sink.Spool.validate(field+".Spool", configErr)
+	case DestinationHTTP:
+		if err := validateHTTPURL(sink.URL); err != nil {
+			configErr.add(field+".URL", err)
+		}
+		if sink.Format != "" && sink.Format != FormatJson {
+			configErr.add(field+".Format", fmt.Errorf("%q is not supported by the http destination", sink.Format))
+		}
+		sink.HTTP.validate(field+".HTTP", configErr)
+		sink.TLS.validate(field+".TLS", configErr)
+		sink.Reconnect.validate(field+".Reconnect", configErr)
+		sink.Spool.validate(field+".Spool", configErr)
+	default:
+		configErr.add(field+".Destination", fmt.Errorf("unknown destination %q", sink.Destination))
+	}
+
+	switch sink.Format {
+	case "", FormatJson, FormatText, FormatLogfmt, FormatConsole, FormatSyslog:
+	default:
+		configErr.add(field+".Format", fmt.Errorf("unknown format %q", sink.Format))
+	}
+	if _, found := syslogFacilities[sink.Facility]; sink.Facility != "" && !found {
+		configErr.add(field+".Facility", fmt.Errorf("unknown facility %q", sink.Facility))
+	}
+	if sink.EnterpriseId != "" && !syslogEnterpriseIdPattern.MatchString(sink.EnterpriseId) {
+		configErr.add(field+".EnterpriseId", fmt.Errorf("%q is not an enterprise number", sink.EnterpriseId))
+	}
+
+	if sink.Level != "" {
+		if _, err := logrus.ParseLevel(sink.Level); err != nil {
+			configErr.add(field+".Level", err)
+		}
+	}
+	if err := validateFieldValue(sink.Name); err != nil {
+		configErr.add(field+".Name", err)
+	}
+}
+
+// name returns the name of the sink in the admin handler.
+func (sink SinkConfig) name() string {
+	if sink.Name != "" {
+		return sink.Name
+	}
+	switch sink.Destination {
+	case DestinationFile:
+		return fmt.Sprintf("%s %s", sink.Destination, sink.Path)
+	case DestinationTCP, DestinationUDP:
+		return fmt.Sprintf("%s %s", sink.Destination, sink.Address)
+	case DestinationHTTP:
+		if parsed, err := url.Parse(sink.URL); err == nil {
+			return fmt.Sprintf("%s %s", sink.Destination, parsed.Redacted())
+		}
+	}
+	return string(sink.Destination)
+}
+
+// String masks the password of the URL, so that printing the config, e.g. in
+// the log of the configuration, doesn't leak it.
+func (sink SinkConfig) String() string {
+	if parsed, err := url.Parse(sink.URL); err == nil {
+		sink.URL = parsed.Redacted()
+	}
+	type plain SinkConfig
+	return fmt.Sprint(plain(sink))
+}
+
+// key identifies the sink across reconfigurations: a sink whose key doesn't
+// change keeps its hook.
+func (sink SinkConfig) key(index int, config Config) string {
+	writer := ""
+	if sink.Writer != nil {
+		writer = fmt.Sprintf("%T", sink.Writer)
+		if value := reflect.ValueOf(sink.Writer); value.Kind() == reflect.Ptr {
+			writer = fmt.Sprintf("%s@%x", writer, value.Pointer())
+		}
+	}
+	return fmt.Sprintf("sink %d %q %s %q %s %q %q %+v %v %+v %+v %+v %q %q %s %+v %+v %+v %v %v %q", index, sink.Name, sink.Destination, sink.Path, writer,
+		sink.Address, sink.URL, sink.HTTP, map[string]string(sink.HTTP.Headers), sink.TLS, sink.Reconnect, sink.Spool, sink.Facility, sink.EnterpriseId,
+		sink.Format, config.rotationPolicy(), config.AdditionalFields, config.Async, config.FlattenFields,
+		config.Colors && sink.Format == FormatConsole, config.AppName)
+}
+
+// build creates the hook of the sink.
+func (sink SinkConfig) build(config Config, level logrus.Level) *JsonLogHook {
+	writer, closer := sink.open(config)
+
+	var hook *JsonLogHook
+	if sink.Format == "" || sink.Format == FormatJson {
+		hook = NewJsonLogHook(level, config.AdditionalFields, writer)
+		hook.SetFlattenFields(config.FlattenFields)
+	} else {
+		hook = NewFormattedLogHook(level, sink.formatter(config), writer)
+	}
+	hook.closer = closer
+	return hook
+}
+
+// open returns the writer of the sink, and its closer when the sink owns it.
+func (sink SinkConfig) open(config Config) (io.Writer, io.Closer) {
+	switch sink.Destination {
+	case DestinationStdout:
+		return os.Stdout, nil
+	case DestinationStderr:
+		return os.Stderr, nil
+	case DestinationWriter:
+		return sink.Writer, nil
+	case DestinationTCP, DestinationUDP:
+		writer := newNetWriter(sink)
+		return writer, writer
+	case DestinationHTTP:
+		writer := newHTTPWriter(sink)
+		return writer, writer
+	}
+
+	file := newRotatingFile(sink.Path, config.rotationPolicy())
+	return file, file
+}
+
+func (sink SinkConfig) formatter(config Config) logrus.Formatter {
+	switch sink.Format {
+	case FormatSyslog:
+		facility, found := syslogFacilities[sink.Facility]
+		if !found {
+			facility = syslogFacilities["user"]
+		}
+		formatter := NewSyslogFormatter(config.AppName, facility, config.AdditionalFields)
+		if sink.EnterpriseId != "" {
+			formatter.SetEnterpriseId(sink.EnterpriseId)
+		}
+		return formatter
+	case FormatLogfmt:
+		return &logrus.TextFormatter{
+			DisableColors:    true,
+			FullTimestamp:    true,
+			TimestampFormat:  TimestampFormat,
+			QuoteEmptyFields: true,
+		}
+	case FormatConsole:
+		return &logrus.TextFormatter{
+			ForceColors:   config.Colors,
+			DisableColors: !config.Colors,
+			FullTimestamp: true,
+		}
+	}
+	return &textFormatter{}
+}
+
+// textFormatter writes an entry as a single human readable line:
+//
+//	2006-01-02T15:04:05.999Z INFO Message key=value
+type textFormatter struct{}
+
+func (f *textFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "%s %s %s", entry.Time.Format(TimestampFormat), strings.ToUpper(entry.Level.String()), entry.Message)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(buffer, " %s=%v", key, entry.Data[key])
+	}
+	if entry.HasCaller() {
+		fmt.Fprintf(buffer, " caller=%s:%d", entry.Caller.File, entry.Caller.Line)
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes(), nil
+}
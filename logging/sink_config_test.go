@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SinksShouldWriteEachFormatAtItsOwnLevel(t *testing.T) {
+	jsonOut, textOut, logfmtOut := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	logger, err := New(Config{
+		Level: "debug",
+		Sinks: []SinkConfig{
+			{Destination: DestinationWriter, Writer: jsonOut, Format: FormatJson},
+			{Destination: DestinationWriter, Writer: textOut, Format: FormatText, Level: "info"},
+			{Destination: DestinationWriter, Writer: logfmtOut, Format: FormatLogfmt, Level: "error"},
+		},
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+	jsonOut.Reset()
+	textOut.Reset()
+
+	logger.GetLog("db").Debug("debug message")
+	logger.GetLog("db").Error("error message")
+
+	jsonLines := strings.Split(strings.TrimSpace(jsonOut.String()), "\n")
+	assert.Len(t, jsonLines, 2)
+	jsonMap := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal([]byte(jsonLines[0]), &jsonMap))
+	assert.Equal(t, "debug message", jsonMap["message"])
+	assert.Equal(t, map[string]interface{}{"obj": "db"}, jsonMap["data"])
+
+	assert.NotContains(t, textOut.String(), "debug message")
+	assert.Regexp(t, `^\S+ ERROR error message obj=db\n$`, textOut.String())
+
+	assert.NotContains(t, logfmtOut.String(), "debug message")
+	assert.Contains(t, logfmtOut.String(), `level=error msg="error message" obj=db`)
+}
+
+func Test_SinksShouldReplaceTheConsoleUntilRemoved(t *testing.T) {
+	logger, err := New(Config{Level: "info"})
+	assert.NoError(t, err)
+	defer logger.Close()
+	console, sink := new(bytes.Buffer), new(bytes.Buffer)
+	logger.setOutput(console)
+
+	config := logger.currentConfig()
+	config.Sinks = []SinkConfig{{Destination: DestinationWriter, Writer: sink, Format: FormatText}}
+	assert.NoError(t, logger.Reload(config))
+	logger.GetLog("test").Info("to sink")
+
+	config.Sinks = nil
+	assert.NoError(t, logger.Reload(config))
+	logger.GetLog("test").Info("to console")
+
+	assert.Contains(t, sink.String(), "to sink")
+	assert.NotContains(t, sink.String(), "to console")
+	assert.NotContains(t, console.String(), "to sink")
+	assert.Contains(t, console.String(), "to console")
+}
+
+func Test_SinksShouldWriteToFile(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "app.log")
+	logger, err := New(Config{
+		Level: "info",
+		Sinks: []SinkConfig{{Destination: DestinationFile, Path: fileName}},
+	})
+	assert.NoError(t, err)
+
+	logger.GetLog("test").Info("to file")
+	assert.NoError(t, logger.Close())
+
+	entries := loadLogFile(fileName)
+	assert.Equal(t, "to file", entries[len(entries)-1]["message"])
+}
+
+func Test_SinksShouldKeepUnchangedHooksOnReload(t *testing.T) {
+	logger, err := New(Config{
+		Level: "info",
+		Sinks: []SinkConfig{{Name: "out", Destination: DestinationWriter, Writer: new(bytes.Buffer)}},
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+	before := logger.runningSinks()
+
+	config := logger.currentConfig()
+	config.Level = "debug"
+	config.Sinks[0].Level = "warn"
+	assert.NoError(t, logger.Reload(config))
+
+	after := logger.runningSinks()
+	assert.Len(t, after, 1)
+	assert.Same(t, before[0].hook, after[0].hook)
+	assert.Equal(t, "out", after[0].name)
+	assert.Equal(t, logrus.WarnLevel, after[0].hook.Level())
+}
+
+func Test_SinksShouldBeValidated(t *testing.T) {
+	config := Config{
+		Level: "info",
+		Sinks: []SinkConfig{
+			{Destination: "socket"},
+			{Destination: DestinationFile},
+			{Destination: DestinationWriter, Format: "xml", Level: "loud"},
+			{Destination: DestinationStdout, Format: FormatSyslog, EnterpriseId: "acme"},
+		},
+	}
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(config.Validate(), &configErr))
+	fields := make([]string, len(configErr.Problems))
+	for i, problem := range configErr.Problems {
+		fields[i] = problem.Field
+	}
+	assert.Equal(t, []string{
+		"Sinks[0].Destination",
+		"Sinks[1].Path",
+		"Sinks[2].Writer",
+		"Sinks[2].Format",
+		"Sinks[2].Level",
+		"Sinks[3].EnterpriseId",
+	}, fields)
+}
@@ -0,0 +1,299 @@
+package logging
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+const defaultSpoolMaxSizeMB = 10
+
+// SpoolConfig holds the entries of a network sink until they are sent, so they
+// survive the destination being unreachable for a while. They are kept in
+// memory, or in the file at Path, which also keeps them across restarts. Once
+// the spool is full, new entries are dropped until the destination is reached
+// again.
+type SpoolConfig struct {
+	// Path is the spool file. Empty keeps the entries in memory.
+	Path string `json:"path" yaml:"path" toml:"path"`
+	// MaxSizeMB defaults to 10.
+	MaxSizeMB int `json:"max_size_mb" yaml:"max_size_mb" toml:"max_size_mb"`
+}
+
+func (config SpoolConfig) validate(field string, configErr *ConfigError) {
+	if config.MaxSizeMB < 0 {
+		configErr.add(field+".MaxSizeMB", fmt.Errorf("%d is negative", config.MaxSizeMB))
+	}
+	if config.Path != "" {
+		if err := validateLogsFolder(path.Dir(config.Path)); err != nil {
+			configErr.add(field+".Path", err)
+		} else if err := validateLogFile(config.Path); err != nil {
+			configErr.add(field+".Path", err)
+		}
+	}
+}
+
+func (config SpoolConfig) maxSize() int64 {
+	if config.MaxSizeMB == 0 {
+		return defaultSpoolMaxSizeMB * megabyte
+	}
+	return int64(config.MaxSizeMB) * megabyte
+}
+
+const megabyte = 1024 * 1024
+
+// spool is a bounded FIFO of messages. It is not safe for concurrent use.
+type spool interface {
+	// push appends the message, and returns false when the spool is full.
+	push(message []byte) (bool, error)
+	// peek returns up to n of the oldest messages.
+	peek(n int) ([][]byte, error)
+	// pop removes the n oldest messages, which must exist.
+	pop(n int) error
+	len() int
+	// size returns the total size of the messages.
+	size() int64
+	close() error
+}
+
+// open returns the spool of config. A spool file that can't be opened is
+// reported to errorOutput and replaced by a memory spool, as the sink must
+// keep working.
+func (config SpoolConfig) open() spool {
+	if config.Path == "" {
+		return &memorySpool{maxSize: config.maxSize()}
+	}
+	retVal, err := openFileSpool(config.Path, config.maxSize())
+	if err != nil {
+		fmt.Fprintf(errorOutput, "Failed to open log spool %s, spooling in memory: %v\n", config.Path, err)
+		return &memorySpool{maxSize: config.maxSize()}
+	}
+	return retVal
+}
+
+type memorySpool struct {
+	messages [][]byte
+	total    int64
+	maxSize  int64
+}
+
+func (s *memorySpool) push(message []byte) (bool, error) {
+	if s.total+int64(len(message)) > s.maxSize {
+		return false, nil
+	}
+	s.messages = append(s.messages, message)
+	s.total += int64(len(message))
+	return true, nil
+}
+
+func (s *memorySpool) peek(n int) ([][]byte, error) {
+	if n > len(s.messages) {
+		n = len(s.messages)
+	}
+	return append([][]byte(nil), s.messages[:n]...), nil
+}
+
+func (s *memorySpool) pop(n int) error {
+	for i := 0; i < n; i++ {
+		s.total -= int64(len(s.messages[i]))
+		s.messages[i] = nil
+	}
+	s.messages = s.messages[n:]
+	return nil
+}
+
+func (s *memorySpool) len() int {
+	return len(s.messages)
+}
+
+func (s *memorySpool) size() int64 {
+	return s.total
+}
+
+func (s *memorySpool) close() error {
+	return nil
+}
+
+// fileSpool keeps the messages in a file: a header holding the offset of the
+// oldest message, followed by the messages, each prefixed by its length. The
+// file is truncated once every message was popped, and compacted once the
+// popped messages take more room than the pending ones and half of maxSize.
+type fileSpool struct {
+	fileName string
+	file     *os.File
+	maxSize  int64
+	readOff  int64
+	writeOff int64
+	count    int
+}
+
+const (
+	fileSpoolHeaderSize = 8
+	fileSpoolLengthSize = 4
+)
+
+func openFileSpool(fileName string, maxSize int64) (*fileSpool, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	retVal := &fileSpool{fileName: fileName, file: file, maxSize: maxSize}
+	if err := retVal.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return retVal, nil
+}
+
+// load finds the messages left by a previous run, dropping a message whose
+// write was interrupted.
+func (s *fileSpool) load() error {
+	header := make([]byte, fileSpoolHeaderSize)
+	if _, err := s.file.ReadAt(header, 0); err != nil {
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		return s.reset()
+	}
+	s.readOff = int64(binary.BigEndian.Uint64(header))
+	s.writeOff = s.readOff
+	if s.readOff < fileSpoolHeaderSize {
+		return s.reset()
+	}
+
+	length := make([]byte, fileSpoolLengthSize)
+	for {
+		if _, err := s.file.ReadAt(length, s.writeOff); err != nil {
+			break
+		}
+		end := s.writeOff + fileSpoolLengthSize + int64(binary.BigEndian.Uint32(length))
+		if info, err := s.file.Stat(); err != nil {
+			return err
+		} else if end > info.Size() {
+			break
+		}
+		s.writeOff = end
+		s.count++
+	}
+	if s.count == 0 {
+		return s.reset()
+	}
+	return s.file.Truncate(s.writeOff)
+}
+
+// reset empties the file.
+func (s *fileSpool) reset() error {
+	s.readOff, s.writeOff, s.count = fileSpoolHeaderSize, fileSpoolHeaderSize, 0
+	if err := s.file.Truncate(fileSpoolHeaderSize); err != nil {
+		return err
+	}
+	return s.writeHeader()
+}
+
+func (s *fileSpool) writeHeader() error {
+	header := make([]byte, fileSpoolHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(s.readOff))
+	_, err := s.file.WriteAt(header, 0)
+	return err
+}
+
+func (s *fileSpool) push(message []byte) (bool, error) {
+	record := make([]byte, fileSpoolLengthSize+len(message))
+	if s.writeOff-s.readOff+int64(len(record)) > s.maxSize {
+		return false, nil
+	}
+	binary.BigEndian.PutUint32(record, uint32(len(message)))
+	copy(record[fileSpoolLengthSize:], message)
+	if _, err := s.file.WriteAt(record, s.writeOff); err != nil {
+		return false, err
+	}
+	s.writeOff += int64(len(record))
+	s.count++
+	return true, nil
+}
+
+func (s *fileSpool) peek(n int) ([][]byte, error) {
+	if n > s.count {
+		n = s.count
+	}
+	retVal := make([][]byte, 0, n)
+	length := make([]byte, fileSpoolLengthSize)
+	for offset := s.readOff; len(retVal) < n; {
+		if _, err := s.file.ReadAt(length, offset); err != nil {
+			return nil, err
+		}
+		message := make([]byte, binary.BigEndian.Uint32(length))
+		if _, err := s.file.ReadAt(message, offset+fileSpoolLengthSize); err != nil {
+			return nil, err
+		}
+		retVal = append(retVal, message)
+		offset += fileSpoolLengthSize + int64(len(message))
+	}
+	return retVal, nil
+}
+
+func (s *fileSpool) pop(n int) error {
+	s.count -= n
+	if s.count == 0 {
+		return s.reset()
+	}
+	length := make([]byte, fileSpoolLengthSize)
+	for i := 0; i < n; i++ {
+		if _, err := s.file.ReadAt(length, s.readOff); err != nil {
+			return err
+		}
+		s.readOff += fileSpoolLengthSize + int64(binary.BigEndian.Uint32(length))
+	}
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	if popped := s.readOff - fileSpoolHeaderSize; popped > s.maxSize/2 && popped > s.writeOff-s.readOff {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact moves the pending messages to the start of a new file, which replaces
+// the spool file once complete, so a crash leaves either file whole.
+func (s *fileSpool) compact() error {
+	pending := make([]byte, s.writeOff-s.readOff)
+	if _, err := s.file.ReadAt(pending, s.readOff); err != nil {
+		return err
+	}
+	tempName := s.fileName + ".tmp"
+	file, err := os.OpenFile(tempName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	content := make([]byte, fileSpoolHeaderSize, fileSpoolHeaderSize+len(pending))
+	binary.BigEndian.PutUint64(content, fileSpoolHeaderSize)
+	if _, err := file.Write(append(content, pending...)); err != nil {
+		file.Close()
+		os.Remove(tempName)
+		return err
+	}
+	if err := os.Rename(tempName, s.fileName); err != nil {
+		file.Close()
+		os.Remove(tempName)
+		return err
+	}
+	s.file.Close()
+	s.file = file
+	s.readOff, s.writeOff = fileSpoolHeaderSize, fileSpoolHeaderSize+int64(len(pending))
+	return nil
+}
+
+func (s *fileSpool) len() int {
+	return s.count
+}
+
+func (s *fileSpool) size() int64 {
+	return s.writeOff - s.readOff - int64(s.count*fileSpoolLengthSize)
+}
+
+func (s *fileSpool) close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,182 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSyslogEnterpriseId is the private enterprise number of the structured
+// data ids unless set, the one RFC 5612 reserves for documentation.
+const defaultSyslogEnterpriseId = "32473"
+
+// syslogEnterpriseIdPattern matches a private enterprise number, optionally
+// followed by sub-identifiers, e.g. "32473.1".
+var syslogEnterpriseIdPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+const syslogTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// syslogFacilities are the facility codes of RFC 5424 by name.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverities are the severities of RFC 5424 by level.
+var syslogSeverities = map[logrus.Level]int{
+	logrus.PanicLevel: 1,
+	logrus.FatalLevel: 2,
+	logrus.ErrorLevel: 3,
+	logrus.WarnLevel:  4,
+	logrus.InfoLevel:  6,
+	logrus.DebugLevel: 7,
+	logrus.TraceLevel: 7,
+}
+
+// SyslogFormatter formats entries as RFC 5424 syslog messages, one per line:
+//
+//	<14>1 2006-01-02T15:04:05.000000Z host app 42 obj [logger@32473 dc="eu"][data@32473 key="value"] Message
+//
+// The LoggerFields go in the "logger" structured data element and the fields of
+// the entry in the "data" one; the obj field is the MSGID. Their ids end with
+// the private enterprise number of SetEnterpriseId.
+type SyslogFormatter struct {
+	facility     int
+	hostname     string
+	appName      string
+	procId       string
+	enterpriseId string
+	loggerParams map[string]interface{}
+	logger       string
+}
+
+// NewSyslogFormatter creates a formatter of the given facility code, e.g. 16
+// for local0. The hostname is fields.Hostname, or the one of the machine.
+func NewSyslogFormatter(appName string, facility int, fields LoggerFields) *SyslogFormatter {
+	hostname := fields.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	params := map[string]interface{}{
+		string(ArtifactIDField):      fields.ArtifactID,
+		string(ArtifactVersionField): fields.ArtifactVersion,
+		string(HostnameField):        fields.Hostname,
+		string(DCField):              fields.Dc,
+	}
+	for name, value := range params {
+		if value == "" {
+			delete(params, name)
+		}
+	}
+
+	retVal := &SyslogFormatter{
+		facility:     facility,
+		hostname:     syslogHeaderField(hostname, 255),
+		appName:      syslogHeaderField(appName, 48),
+		procId:       strconv.Itoa(os.Getpid()),
+		loggerParams: params,
+	}
+	retVal.SetEnterpriseId(defaultSyslogEnterpriseId)
+	return retVal
+}
+
+// SetEnterpriseId sets the private enterprise number assigned by IANA to the
+// organization, e.g. "32473", ending the structured data ids. It defaults to the
+// number RFC 5612 reserves for documentation. It must be set before the
+// formatter is used.
+func (f *SyslogFormatter) SetEnterpriseId(enterpriseId string) {
+	f.enterpriseId = enterpriseId
+	f.logger = syslogElement("logger", enterpriseId, f.loggerParams)
+}
+
+func (f *SyslogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	obj, _ := entry.Data[FieldNameObj].(string)
+	data := make(map[string]interface{}, len(entry.Data))
+	for key, value := range entry.Data {
+		if key != FieldNameObj {
+			data[key] = value
+		}
+	}
+
+	structuredData := f.logger + syslogElement("data", f.enterpriseId, data)
+	if structuredData == "" {
+		structuredData = "-"
+	}
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "<%d>1 %s %s %s %s %s %s",
+		f.facility*8+syslogSeverities[entry.Level],
+		entry.Time.Format(syslogTimestampFormat),
+		f.hostname,
+		f.appName,
+		f.procId,
+		syslogHeaderField(obj, 32),
+		structuredData)
+	if entry.Message != "" {
+		buffer.WriteByte(' ')
+		buffer.WriteString(strings.ReplaceAll(entry.Message, "\n", " "))
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes(), nil
+}
+
+// syslogHeaderField returns value as a header field of at most max printable
+// ASCII characters, or the nil value "-" when empty.
+func syslogHeaderField(value string, max int) string {
+	retVal := syslogName(value, max, "")
+	if retVal == "" {
+		return "-"
+	}
+	return retVal
+}
+
+// syslogName keeps the printable ASCII characters of value, except those in
+// excluded, up to max of them.
+func syslogName(value string, max int, excluded string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		if builder.Len() == max {
+			break
+		}
+		if r > ' ' && r <= '~' && !strings.ContainsRune(excluded, r) {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// syslogElement returns the structured data element with the given name and
+// params sorted by name, or "" without params.
+func syslogElement(name string, enterpriseId string, params map[string]interface{}) string {
+	if len(params) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(params))
+	for param := range params {
+		names = append(names, param)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	builder.WriteString("[" + name + "@" + enterpriseId)
+	for _, param := range names {
+		paramName := syslogName(param, 32, `="]`)
+		if paramName == "" {
+			continue
+		}
+		value := fmt.Sprint(params[param])
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+		fmt.Fprintf(&builder, ` %s="%s"`, paramName, value)
+	}
+	builder.WriteString("]")
+	return builder.String()
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SyslogFormatterShouldFormatRfc5424(t *testing.T) {
+	formatter := NewSyslogFormatter("my app", syslogFacilities["local0"], LoggerFields{Hostname: "host-1", Dc: "eu"})
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		FieldNameObj: "db",
+		"query":      `select "x"]`,
+		"bad key":    1,
+	})
+	entry.Time = time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	entry.Level = logrus.WarnLevel
+	entry.Message = "slow\nquery"
+
+	formatted, err := formatter.Format(entry)
+
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`<132>1 2020-01-02T03:04:05.000006Z host-1 myapp %d db `, os.Getpid())+
+		`[logger@32473 HOSTNAME="host-1" dc="eu"][data@32473 badkey="1" query="select \"x\"\]"] slow query`+"\n", string(formatted))
+}
+
+func Test_SyslogFormatterShouldUseNilValues(t *testing.T) {
+	formatter := NewSyslogFormatter("", syslogFacilities["user"], LoggerFields{Hostname: "host-1"})
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+
+	formatted, err := formatter.Format(entry)
+
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<14>1 \S+ host-1 - \d+ - \[logger@32473 HOSTNAME="host-1"\]\n$`, string(formatted))
+}
+
+func Test_SyslogFormatterShouldUseTheEnterpriseIdOfTheOrganization(t *testing.T) {
+	formatter := NewSyslogFormatter("app", syslogFacilities["user"], LoggerFields{Hostname: "host-1"})
+	formatter.SetEnterpriseId("99999")
+	entry := logrus.NewEntry(logrus.New()).WithField("key", "value")
+	entry.Level = logrus.InfoLevel
+
+	formatted, err := formatter.Format(entry)
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(formatted), `[logger@99999 HOSTNAME="host-1"][data@99999 key="value"]`)
+}
@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldNameTailDropped holds the number of entries a trace's tail buffer
+// dropped for lack of room, in the entry logged before the buffer is flushed.
+const FieldNameTailDropped = "tail_dropped"
+
+// TailBufferConfig keeps the debug entries of every trace started by
+// Logger.NewTrace in memory, even when Level filters them out. They are logged
+// with their original timestamps if the trace fails, i.e. a segment calls
+// EndWithErrorIf with an error or Trace.MarkFailed is called, and discarded by
+// Trace.Finish otherwise. Once a trace failed, its debug entries are logged
+// right away.
+type TailBufferConfig struct {
+	// Size is the number of entries kept per trace, the oldest being dropped
+	// first. Zero disables the tail buffers.
+	Size int `json:"size" yaml:"size" toml:"size" env:"SIZE"`
+	// Level is the most verbose level kept, "debug" or "trace". It defaults to
+	// "debug".
+	Level string `json:"level" yaml:"level" toml:"level" env:"LEVEL"`
+}
+
+func (config TailBufferConfig) validate(field string, configErr *ConfigError) {
+	if config.Size < 0 {
+		configErr.add(field+".Size", fmt.Errorf("%d is negative", config.Size))
+	}
+	if config.Level != "" {
+		if level, err := logrus.ParseLevel(config.Level); err != nil {
+			configErr.add(field+".Level", err)
+		} else if level < logrus.DebugLevel {
+			configErr.add(field+".Level", fmt.Errorf("%q is not debug or trace", config.Level))
+		}
+	}
+}
+
+// level returns the most verbose level kept, or the zero PanicLevel when the
+// tail buffers are disabled.
+func (config TailBufferConfig) level() logrus.Level {
+	if config.Size == 0 {
+		return logrus.PanicLevel
+	}
+	if config.Level == "" {
+		return logrus.DebugLevel
+	}
+	level, _ := logrus.ParseLevel(config.Level)
+	return level
+}
+
+type tailBufferKey struct{}
+
+// withTailBuffer returns ctx carrying buffer, so that the dispatcher finds the
+// buffer of the entries logged through a trace.
+func withTailBuffer(ctx context.Context, buffer *tailBuffer) context.Context {
+	return context.WithValue(contextOrBackground(ctx), tailBufferKey{}, buffer)
+}
+
+func tailBufferOf(entry *logrus.Entry) *tailBuffer {
+	if entry.Context == nil {
+		return nil
+	}
+	buffer, _ := entry.Context.Value(tailBufferKey{}).(*tailBuffer)
+	return buffer
+}
+
+// tailBuffer is the bounded ring of the debug entries of a trace.
+type tailBuffer struct {
+	level logrus.Level
+
+	lock     sync.Mutex
+	ring     []*logrus.Entry
+	head     int
+	count    int
+	dropped  int
+	failed   bool
+	finished bool
+}
+
+func newTailBuffer(size int, level logrus.Level) *tailBuffer {
+	return &tailBuffer{
+		level: level,
+		ring:  make([]*logrus.Entry, size),
+	}
+}
+
+// keeps reports whether entries at level are held by the buffer.
+func (b *tailBuffer) keeps(level logrus.Level) bool {
+	return level >= logrus.DebugLevel && level <= b.level
+}
+
+// hold keeps a copy of the entry until the trace fails or finishes, and
+// returns false once the trace failed, when the entry must be logged instead.
+func (b *tailBuffer) hold(entry *logrus.Entry) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.failed {
+		return false
+	}
+	if b.finished {
+		return true
+	}
+
+	held := entry.Dup()
+	held.Level = entry.Level
+	held.Message = entry.Message
+	if b.count == len(b.ring) {
+		b.head = (b.head + 1) % len(b.ring)
+		b.count--
+		b.dropped++
+	}
+	b.ring[(b.head+b.count)%len(b.ring)] = held
+	b.count++
+	return true
+}
+
+// fail logs the held entries with their original timestamps.
+func (b *tailBuffer) fail() {
+	b.lock.Lock()
+	if b.failed || b.finished {
+		b.lock.Unlock()
+		return
+	}
+	b.failed = true
+	held := make([]*logrus.Entry, b.count)
+	for i := range held {
+		held[i] = b.ring[(b.head+i)%len(b.ring)]
+	}
+	dropped := b.dropped
+	b.ring = nil
+	b.lock.Unlock()
+
+	if len(held) == 0 {
+		return
+	}
+	if dropped > 0 {
+		held[0].WithContext(bypassStages(held[0].Context)).
+			WithField(FieldNameTailDropped, dropped).
+			Log(held[0].Level, fmt.Sprintf("%d earlier entries of the trace were dropped", dropped))
+	}
+	for _, entry := range held {
+		entry.WithContext(bypassStages(entry.Context)).Log(entry.Level, entry.Message)
+	}
+}
+
+// finish discards the held entries, unless the trace failed.
+func (b *tailBuffer) finish() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.finished = true
+	b.ring = nil
+	b.count = 0
+}
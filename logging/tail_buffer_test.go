@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TailBufferShouldDiscardDebugEntriesOfSuccessfulTraces(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", TailBuffer: TailBufferConfig{Size: 10}})
+
+	trace := logger.NewTrace("checkout")
+	segment := trace.StartSegment("pay")
+	segment.Log().Debug("calling the bank")
+	segment.EndWithErrorIf(nil)
+	trace.Finish()
+	trace.MarkFailed()
+
+	assert.Equal(t, []string{"", ""}, console.messages())
+	assert.Equal(t, "end", console.last()[FieldNameMarker])
+}
+
+func Test_TailBufferShouldFlushDebugEntriesWhenTheTraceFails(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", TailBuffer: TailBufferConfig{Size: 10}})
+	loggedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+
+	trace := logger.NewTrace("checkout")
+	segment := trace.StartSegment("pay")
+	segment.Log().WithTime(loggedAt).Debug("calling the bank")
+	segment.Log().Trace("not held")
+	logger.GetLog("other").Debug("not in a trace")
+	segment.EndWithErrorIf(errors.New("declined"))
+
+	assert.Equal(t, []string{"", "calling the bank", "declined"}, console.messages())
+	assert.Equal(t, loggedAt.Format(time.RFC3339), console.entries[1]["time"])
+	assert.Equal(t, "debug", console.entries[1]["level"])
+
+	trace.Log().Debug("after the failure")
+	assert.Equal(t, "after the failure", console.last()["msg"])
+}
+
+func Test_TailBufferShouldBeBounded(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", TailBuffer: TailBufferConfig{Size: 2, Level: "trace"}})
+
+	trace := logger.NewTrace("import")
+	trace.Log().Debug("row 1")
+	trace.Log().Trace("row 2")
+	trace.Log().Debug("row 3")
+	assert.Empty(t, console.messages())
+
+	trace.MarkFailed()
+	assert.Equal(t, []string{"1 earlier entries of the trace were dropped", "row 2", "row 3"}, console.messages())
+	assert.Equal(t, "1", console.entries[0][FieldNameTailDropped])
+	assert.Equal(t, "trace", console.entries[1]["level"])
+}
+
+func Test_TailBufferShouldBeValidated(t *testing.T) {
+	config := Config{Level: "info", TailBuffer: TailBufferConfig{Size: -1, Level: "info"}}
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(config.Validate(), &configErr))
+	assert.Len(t, configErr.Problems, 2)
+	assert.Equal(t, "TailBuffer.Size", configErr.Problems[0].Field)
+	assert.Equal(t, "TailBuffer.Level", configErr.Problems[1].Field)
+}
@@ -1,6 +1,8 @@
 package logging
 
 import (
+	"context"
+
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -8,6 +10,8 @@ import (
 const FieldNameAction = "action"
 const FieldNameTraceId = "trace_id"
 const FieldNameSegment = "segment"
+const FieldNameSegmentId = "segment_id"
+const FieldNameParentSegmentId = "parent_segment_id"
 const FieldNameMarker = "marker"
 const FieldNameDuration = "duration_sec"
 const MarkerStart = "start"
@@ -15,16 +19,38 @@ const MarkerEnd = "end"
 
 type Trace interface {
 	StartSegment(segmentName string, args ...interface{}) Segment
+	// StartSegmentCtx starts a segment, and returns it with a child of ctx
+	// carrying it and the trace. See SegmentFromContext.
+	StartSegmentCtx(ctx context.Context, segmentName string, args ...interface{}) (context.Context, Segment)
 	NewSegment() SegmentBuilder
 	AddField(name string, value interface{}) Trace
 	Log() *logrus.Entry
 	Id() string
+	// MarkFailed logs the debug entries held by the tail buffer of the trace,
+	// and the following ones right away.
+	MarkFailed()
+	// Finish discards the debug entries held by the tail buffer of the trace,
+	// unless it failed.
+	Finish()
+	// TraceParent returns the W3C Trace Context of the call the trace was
+	// continued from, see ContinueTrace.
+	TraceParent() (TraceParent, bool)
+	TraceState() TraceState
+	// Sampled reports whether the trace is recorded: always for the traces
+	// started here, as decided by the caller for the continued ones.
+	Sampled() bool
 }
 
 type trace struct {
 	logger *logrus.Entry
 	name   string
 	id     string
+	tail   *tailBuffer
+	// w3c is set when the segment ids are W3C parent ids.
+	w3c     bool
+	caller  *TraceParent
+	state   TraceState
+	sampled bool
 }
 
 func NewTrace(action string, logger *logrus.Entry) Trace {
@@ -35,9 +61,42 @@ func NewTrace(action string, logger *logrus.Entry) Trace {
 
 func NewTraceWithId(id string, action string, logger *logrus.Entry) Trace {
 	return &trace{
-		logger: logger,
-		name:   action,
-		id:     id,
+		logger:  logger,
+		name:    action,
+		id:      id,
+		tail:    tailBufferOf(logger),
+		sampled: true,
+	}
+}
+
+// NewW3CTrace starts a trace with the ids of the W3C Trace Context, see
+// TraceIdsW3C.
+func NewW3CTrace(action string, logger *logrus.Entry) Trace {
+	return &trace{
+		logger:  logger,
+		name:    action,
+		id:      newW3CTraceId(),
+		tail:    tailBufferOf(logger),
+		w3c:     true,
+		sampled: true,
+	}
+}
+
+// ContinueTrace starts a trace continuing the one of the caller, e.g. parsed
+// from the traceparent and tracestate headers of a request by ParseTraceParent
+// and ParseTraceState. It keeps the trace id and the sampled flag of the
+// caller, and its root segments get the parent id of the caller, if any, as
+// parent_segment_id. Its segments get W3C ids when the trace id is a W3C one.
+func ContinueTrace(action string, parent TraceParent, state TraceState, logger *logrus.Entry) Trace {
+	return &trace{
+		logger:  logger,
+		name:    action,
+		id:      parent.TraceId,
+		tail:    tailBufferOf(logger),
+		w3c:     isHexId(parent.TraceId, 32),
+		caller:  &parent,
+		state:   state,
+		sampled: parent.Sampled,
 	}
 }
 
@@ -45,6 +104,11 @@ func (t *trace) StartSegment(segmentName string, args ...interface{}) Segment {
 	return t.NewSegment().Start(segmentName, args...)
 }
 
+func (t *trace) StartSegmentCtx(ctx context.Context, segmentName string, args ...interface{}) (context.Context, Segment) {
+	s := t.StartSegment(segmentName, args...)
+	return ContextWithSegment(ctx, s), s
+}
+
 func (t *trace) Log() *logrus.Entry {
 	return baseEntryForTrace(t)
 }
@@ -65,6 +129,41 @@ func (t *trace) Id() string {
 	return t.id
 }
 
+func (t *trace) MarkFailed() {
+	if t.tail != nil {
+		t.tail.fail()
+	}
+}
+
+func (t *trace) Finish() {
+	if t.tail != nil {
+		t.tail.finish()
+	}
+}
+
+func (t *trace) TraceParent() (TraceParent, bool) {
+	if t.caller == nil {
+		return TraceParent{}, false
+	}
+	return *t.caller, true
+}
+
+func (t *trace) TraceState() TraceState {
+	return t.state
+}
+
+func (t *trace) Sampled() bool {
+	return t.sampled
+}
+
+// newSegmentId returns the id of a new segment of the trace.
+func (t *trace) newSegmentId() string {
+	if t.w3c {
+		return newW3CParentId()
+	}
+	return uuid.New().String()
+}
+
 func baseEntryForTrace(trace *trace) *logrus.Entry {
 	return trace.logger.WithFields(
 		logrus.Fields{
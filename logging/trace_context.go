@@ -0,0 +1,204 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TraceIdFormat is the format of the ids generated for the traces and their
+// segments.
+type TraceIdFormat string
+
+const (
+	// TraceIdsUUID generates UUIDs, the default.
+	TraceIdsUUID TraceIdFormat = "uuid"
+	// TraceIdsW3C generates the ids of the W3C Trace Context: 16 random bytes
+	// for the traces and 8 for the segments, in lowercase hex. See TraceParent.
+	TraceIdsW3C TraceIdFormat = "w3c"
+)
+
+func (format TraceIdFormat) validate(field string, configErr *ConfigError) {
+	switch format {
+	case "", TraceIdsUUID, TraceIdsW3C:
+	default:
+		configErr.add(field, fmt.Errorf("%q is not uuid or w3c", string(format)))
+	}
+}
+
+const (
+	traceParentVersion   = "00"
+	traceFlagSampled     = 0x01
+	maxTraceStateMembers = 32
+)
+
+// TraceParent is the W3C Trace Context of a call, sent in the traceparent
+// header, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+type TraceParent struct {
+	// TraceId is the id of the whole trace, 32 hex digits.
+	TraceId string
+	// ParentId is the id of the segment making the call, 16 hex digits.
+	ParentId string
+	// Sampled is set when the caller records the trace.
+	Sampled bool
+}
+
+var (
+	traceParentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})(-.*)?$`)
+	zeroTraceId        = strings.Repeat("0", 32)
+	zeroParentId       = strings.Repeat("0", 16)
+)
+
+// ParseTraceParent parses a traceparent header. The headers of future
+// versions are accepted as long as they start like version 00.
+func ParseTraceParent(header string) (TraceParent, error) {
+	header = strings.TrimSpace(header)
+	match := traceParentPattern.FindStringSubmatch(header)
+	if match == nil {
+		return TraceParent{}, fmt.Errorf("malformed traceparent %q", header)
+	}
+	version, traceId, parentId, flags, rest := match[1], match[2], match[3], match[4], match[5]
+	switch {
+	case version == "ff":
+		return TraceParent{}, fmt.Errorf("invalid traceparent version in %q", header)
+	case version == traceParentVersion && rest != "":
+		return TraceParent{}, fmt.Errorf("malformed traceparent %q", header)
+	case traceId == zeroTraceId:
+		return TraceParent{}, fmt.Errorf("invalid trace id in traceparent %q", header)
+	case parentId == zeroParentId:
+		return TraceParent{}, fmt.Errorf("invalid parent id in traceparent %q", header)
+	}
+
+	flagBits, _ := hex.DecodeString(flags)
+	return TraceParent{
+		TraceId:  traceId,
+		ParentId: parentId,
+		Sampled:  flagBits[0]&traceFlagSampled != 0,
+	}, nil
+}
+
+// String returns the traceparent header, in version 00.
+func (p TraceParent) String() string {
+	flags := "00"
+	if p.Sampled {
+		flags = "01"
+	}
+	return traceParentVersion + "-" + p.TraceId + "-" + p.ParentId + "-" + flags
+}
+
+// TraceState is the vendor specific data of a W3C Trace Context, sent in the
+// tracestate header, e.g. congo=t61rcWkgMzE,rojo=00f067aa0ba902b7. It is
+// passed on unchanged by the traces continuing it.
+type TraceState struct {
+	members []traceStateMember
+}
+
+type traceStateMember struct {
+	key   string
+	value string
+}
+
+var (
+	traceStateKeyPattern   = regexp.MustCompile(`^([a-z][_0-9a-z\-*/]{0,255}|[a-z0-9][_0-9a-z\-*/]{0,240}@[a-z][_0-9a-z\-*/]{0,13})$`)
+	traceStateValuePattern = regexp.MustCompile(`^[\x20-\x2b\x2d-\x3c\x3e-\x7e]{0,255}[\x21-\x2b\x2d-\x3c\x3e-\x7e]$`)
+)
+
+// ParseTraceState parses the tracestate headers of a call, which are combined
+// when there are several.
+func ParseTraceState(headers ...string) (TraceState, error) {
+	var retVal TraceState
+	seen := make(map[string]bool)
+	for _, header := range headers {
+		for _, member := range strings.Split(header, ",") {
+			member = strings.Trim(member, " \t")
+			if member == "" {
+				continue
+			}
+			key, value, found := strings.Cut(member, "=")
+			if !found || !traceStateKeyPattern.MatchString(key) || !traceStateValuePattern.MatchString(value) {
+				return TraceState{}, fmt.Errorf("malformed tracestate member %q", member)
+			}
+			if seen[key] {
+				return TraceState{}, fmt.Errorf("duplicate tracestate key %q", key)
+			}
+			seen[key] = true
+			retVal.members = append(retVal.members, traceStateMember{key: key, value: value})
+		}
+	}
+	if len(retVal.members) > maxTraceStateMembers {
+		return TraceState{}, fmt.Errorf("%d tracestate members, more than %d", len(retVal.members), maxTraceStateMembers)
+	}
+	return retVal, nil
+}
+
+// Get returns the value of the key.
+func (s TraceState) Get(key string) (string, bool) {
+	for _, member := range s.members {
+		if member.key == key {
+			return member.value, true
+		}
+	}
+	return "", false
+}
+
+// With returns a copy of s with the value of the key set and moved first, as
+// done by a vendor updating its data. The last member is dropped when there
+// would be more than 32.
+func (s TraceState) With(key string, value string) (TraceState, error) {
+	if !traceStateKeyPattern.MatchString(key) {
+		return s, fmt.Errorf("invalid tracestate key %q", key)
+	}
+	if !traceStateValuePattern.MatchString(value) {
+		return s, fmt.Errorf("invalid tracestate value %q", value)
+	}
+	members := []traceStateMember{{key: key, value: value}}
+	for _, member := range s.members {
+		if member.key != key && len(members) < maxTraceStateMembers {
+			members = append(members, member)
+		}
+	}
+	return TraceState{members: members}, nil
+}
+
+// String returns the tracestate header, empty when there is no member.
+func (s TraceState) String() string {
+	members := make([]string, len(s.members))
+	for i, member := range s.members {
+		members[i] = member.key + "=" + member.value
+	}
+	return strings.Join(members, ",")
+}
+
+var hexIdPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// isHexId reports whether id is a valid W3C id of size hex digits.
+func isHexId(id string, size int) bool {
+	return len(id) == size && hexIdPattern.MatchString(id) && id != strings.Repeat("0", size)
+}
+
+// newW3CTraceId returns a random trace id of the W3C Trace Context.
+func newW3CTraceId() string {
+	return randomHexId(16)
+}
+
+// newW3CParentId returns a random parent id of the W3C Trace Context, used as
+// segment id.
+func newW3CParentId() string {
+	return randomHexId(8)
+}
+
+func randomHexId(size int) string {
+	id := make([]byte, size)
+	for {
+		if _, err := rand.Read(id); err != nil {
+			panic(fmt.Errorf("failed to generate a trace id: %w", err))
+		}
+		for _, b := range id {
+			if b != 0 {
+				return hex.EncodeToString(id)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseTraceParentShouldFollowTheW3CSpecification(t *testing.T) {
+	parent, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(t, err)
+	assert.Equal(t, TraceParent{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", ParentId: "00f067aa0ba902b7", Sampled: true}, parent)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", parent.String())
+
+	parent, err = ParseTraceParent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-08-future")
+	assert.NoError(t, err)
+	assert.False(t, parent.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", parent.String())
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	} {
+		_, err := ParseTraceParent(header)
+		assert.Error(t, err, header)
+	}
+}
+
+func Test_ParseTraceStateShouldFollowTheW3CSpecification(t *testing.T) {
+	state, err := ParseTraceState("congo=t61rcWkgMzE, ,tenant@vendor=a b", "rojo=00f067aa0ba902b7")
+	assert.NoError(t, err)
+	assert.Equal(t, "congo=t61rcWkgMzE,tenant@vendor=a b,rojo=00f067aa0ba902b7", state.String())
+	value, found := state.Get("rojo")
+	assert.True(t, found)
+	assert.Equal(t, "00f067aa0ba902b7", value)
+
+	state, err = state.With("rojo", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "rojo=1,congo=t61rcWkgMzE,tenant@vendor=a b", state.String())
+	_, err = state.With("Rojo", "1")
+	assert.Error(t, err)
+
+	for _, header := range []string{"congo", "Congo=1", "congo=a,congo=b", "congo=a=b", "congo="} {
+		_, err := ParseTraceState(header)
+		assert.Error(t, err, header)
+	}
+}
+
+func Test_W3CTracesShouldGenerateW3CIds(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info", TraceIds: TraceIdsW3C})
+
+	trace := logger.NewTrace("checkout")
+	segment := trace.StartSegment("pay")
+
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{32}$`), trace.Id())
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{16}$`), segment.Id())
+	assert.Equal(t, segment.Id(), console.last()[FieldNameSegmentId])
+	assert.True(t, trace.Sampled())
+	_, continued := trace.TraceParent()
+	assert.False(t, continued)
+
+	parent, ok := segment.TraceParent()
+	assert.True(t, ok)
+	assert.Equal(t, TraceParent{TraceId: trace.Id(), ParentId: segment.Id(), Sampled: true}, parent)
+
+	_, ok = NewTrace("uuid", logger.GetLog("test")).StartSegment("pay").TraceParent()
+	assert.False(t, ok)
+}
+
+func Test_ContinuedTracesShouldKeepTheContextOfTheCaller(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info"})
+	caller, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.NoError(t, err)
+	state, err := ParseTraceState("congo=t61rcWkgMzE")
+	assert.NoError(t, err)
+
+	trace := logger.ContinueTrace("checkout", caller, state)
+	segment := trace.StartSegment("pay")
+
+	assert.Equal(t, caller.TraceId, console.last()[FieldNameTraceId])
+	assert.Equal(t, caller.ParentId, console.last()[FieldNameParentSegmentId])
+	assert.False(t, trace.Sampled())
+	assert.Equal(t, "congo=t61rcWkgMzE", trace.TraceState().String())
+	continued, ok := trace.TraceParent()
+	assert.True(t, ok)
+	assert.Equal(t, caller, continued)
+
+	outgoing, ok := segment.TraceParent()
+	assert.True(t, ok)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+segment.Id()+"-00", outgoing.String())
+
+	segment.StartChild("bank")
+	assert.Equal(t, segment.Id(), console.last()[FieldNameParentSegmentId])
+}
+
+func Test_TraceIdsShouldBeValidated(t *testing.T) {
+	config := Config{Level: "info", TraceIds: "b3"}
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(config.Validate(), &configErr))
+	assert.Equal(t, []string{"TraceIds"}, problemFields(configErr))
+}
@@ -2,9 +2,11 @@ package logging
 
 import (
 	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
 )
 
@@ -348,6 +350,50 @@ func Test_AddFieldShouldAddTheSpecifiedFieldToTheSegment(t *testing.T) {
 	assertLastEntryHasFieldWith(expectedFieldName, expectedFieldValue, hook, t)
 }
 
+func Test_ChildSegmentsShouldReferenceTheirParentSegment(t *testing.T) {
+	hook, entry := newTestLogger()
+	expectedAction := randomStr()
+	expectedChild := randomStr()
+
+	trace := NewTrace(expectedAction, entry)
+	parent := trace.StartSegment(randomStr())
+	assertLastEntryHasFieldWith(FieldNameSegmentId, parent.Id(), hook, t)
+	assertLastEntryDoesNotHaveField(FieldNameParentSegmentId, hook, t)
+
+	child := parent.StartChild(expectedChild)
+	assertLastEntryWithStartMarkerAndWith(t, expectedAction, expectedChild, hook)
+	assertLastEntryHasFieldWith(FieldNameSegmentId, child.Id(), hook, t)
+	assertLastEntryHasFieldWith(FieldNameParentSegmentId, parent.Id(), hook, t)
+	assert.NotEqual(t, parent.Id(), child.Id())
+	assert.Equal(t, trace, child.Parent())
+	assert.Equal(t, parent, child.ParentSegment())
+	assert.Nil(t, parent.ParentSegment())
+
+	child.End()
+	assertLastEntryWithEndMarkerAndWith(t, expectedAction, expectedChild, hook)
+	assertLastEntryHasFieldWith(FieldNameParentSegmentId, parent.Id(), hook, t)
+}
+
+func Test_ChildSegmentsShouldInheritTheFieldsOfTheirParentSegment(t *testing.T) {
+	hook, entry := newTestLogger()
+	expectedAction := randomStr()
+	expectedChild := randomStr()
+	expectedFieldName := randomStr()
+	expectedFieldValue := randomStr()
+
+	parent := NewTrace(expectedAction, entry).
+		NewSegment().
+		WithErrorMarkersOnly().
+		Start(randomStr()).
+		AddField(expectedFieldName, expectedFieldValue)
+
+	child := parent.NewChild().WithDebugMarkers().Start(expectedChild)
+	assertLastEntryWithMarkerAndLevelWith(t, logrus.DebugLevel, expectedAction, expectedChild, MarkerStart, hook)
+	assertLastEntryHasFieldWith(expectedFieldName, expectedFieldValue, hook, t)
+	assertLastEntryHasFieldWith(FieldNameParentSegmentId, parent.Id(), hook, t)
+	assert.Equal(t, parent, child.ParentSegment())
+}
+
 func newTestLogger() (*test.Hook, *logrus.Entry) {
 	nullLogger, hook := test.NewNullLogger()
 	nullLogger.Level = logrus.DebugLevel
@@ -411,3 +457,29 @@ func assertLastEntryHasAllFields(expectedFields map[string]interface{}, hook *te
 		assertLastEntryHasFieldWith(key, value, hook, t)
 	}
 }
+
+func Test_SegmentMarkersShouldNotReportReflectionAsCaller(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "debug", ReportCaller: true})
+	segment := logger.NewTrace("checkout").NewSegment().WithDebugMarkers().Start("pay")
+	segment.Mark("charged")
+	segment.End()
+
+	assert.Equal(t, []string{"debug", "debug", "debug"}, []string{console.entries[0]["level"], console.entries[1]["level"], console.entries[2]["level"]})
+	for _, entry := range console.entries {
+		assert.NotContains(t, entry["file"], "reflect")
+		assert.Contains(t, entry["file"], "trace_test.go:")
+	}
+}
+
+func Test_SegmentEndWithAnErrorShouldNotAddAnErrorField(t *testing.T) {
+	logger, console := newJsonConsoleLogger(t, Config{Level: "info"})
+	trace := logger.NewTrace("checkout")
+
+	trace.StartSegment("pay").EndWithErrorIf(fmt.Errorf("failed: %w", os.ErrNotExist))
+	assert.Equal(t, "failed: file does not exist", console.last()["msg"])
+	assert.NotContains(t, console.last(), logrus.ErrorKey)
+
+	trace.StartSegment("ship").EndWithWarningIf(errors.New("late"))
+	assert.Equal(t, "warning", console.last()["level"])
+	assert.NotContains(t, console.last(), logrus.ErrorKey)
+}